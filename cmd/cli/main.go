@@ -1,27 +1,62 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/config"
+	"wilbertopachecob/snippetbox/pkg/migrations"
+	"wilbertopachecob/snippetbox/pkg/models"
 	"wilbertopachecob/snippetbox/pkg/models/mysql"
+	"wilbertopachecob/snippetbox/pkg/models/sqlite"
 
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/joho/godotenv"
 )
 
-func getEnvVar(key string) string {
-	// load .env file
-	err := godotenv.Load(".env")
-
-	if err != nil {
-		log.Fatalf("Error loading .env file")
+// store holds the models the CLI uses. Both the mysql and the sqlite packages
+// implement them.
+type store struct {
+	snippets interface {
+		DeleteExpired(context.Context) (int, error)
+		Get(context.Context, int) (*models.Snippet, error)
+		List(context.Context, int, int) ([]*models.Snippet, int, error)
+		Search(context.Context, string, int, int) ([]*models.Snippet, int, error)
+	}
+	users interface {
+		Get(context.Context, int) (*models.User, error)
+		GetByEmail(context.Context, string) (*models.User, error)
+		SetRole(context.Context, int, string) error
+	}
+	audit interface {
+		Insert(context.Context, int, string, string, string, string) error
+		Export(context.Context, time.Time, time.Time, func(*models.AuditEvent) error) error
 	}
+}
 
-	return os.Getenv(key)
+// newStore returns the models for the given database driver, with each
+// query limited to timeout.
+func newStore(driver string, db *sql.DB, timeout time.Duration) *store {
+	if driver == config.DriverSQLite {
+		return &store{
+			snippets: &sqlite.SnippetModel{DB: db, Timeout: timeout},
+			users:    &sqlite.UserModel{DB: db, Timeout: timeout},
+			audit:    &sqlite.AuditModel{DB: db, Timeout: timeout},
+		}
+	}
+	return &store{
+		snippets: &mysql.SnippetModel{DB: db, Timeout: timeout},
+		users:    &mysql.UserModel{DB: db, Timeout: timeout},
+		audit:    &mysql.AuditModel{DB: db, Timeout: timeout},
+	}
 }
 
 func showHelp() {
@@ -29,10 +64,31 @@ func showHelp() {
 	Usage Snippets CLI
 	Options:
 		-show	        Shows [snippets]			(usage="snippets")
+		-page	        The page of snippets to show		(usage=2, default 1)
+		-page-size      The number of snippets per page		(usage=20, default 10)
 		-h	        	Shows help			
+		-config         Path to a YAML config file		(usage="snippetbox.yml")
+		-db-driver      The database driver			(usage="mysql|sqlite", default mysql)
+		-db-host, -db-name, -db-user, -db-password
+		                Override the database settings
 		get	[options]	Get a user or snippet		(usage=-model "user" -id 1)
 			-model      The model name				(usage="user|snippet")
 			-id         The id of the model			(usage=1)
+		search [options] Search snippets by title and content	(usage=-q "pond")
+			-q          The words to search for			(usage="old pond")
+			-page       The page of results to show		(usage=2, default 1)
+			-page-size  The number of results per page		(usage=20, default 10)
+		set-role [options] Change the role of a user		(usage=-email "alice@example.com" -role admin)
+			-email      The email address of the user
+			-role       The new role				(usage="user|moderator|admin")
+		audit [options]  Export the audit log, oldest first	(usage=-since 2021-04-01 -format csv)
+			-since      The first day to export			(usage=2021-04-01)
+			-until      The last day to export			(usage=2021-04-30)
+			-format     The output format			(usage="json|csv", default json)
+		purge-expired   Permanently delete expired snippets
+		migrate up      Apply every pending schema migration
+		migrate down    Revert the most recently applied migration
+		migrate status  List the migrations and whether they are applied
 	`)
 }
 
@@ -47,26 +103,54 @@ func main() {
 	flag.StringVar(&strF, "show", "", "")
 	var helpF bool
 	flag.BoolVar(&helpF, "h", false, "")
+	page := flag.Int("page", 1, "the page of snippets to show")
+	pageSize := flag.Int("page-size", 10, "the number of snippets per page")
 
 	getCMD := flag.NewFlagSet("get", flag.ExitOnError)
 	model := getCMD.String("model", "", "string representing the model")
 	id := getCMD.Int("id", 0, "an integer representing the model id")
 
+	searchCMD := flag.NewFlagSet("search", flag.ExitOnError)
+	q := searchCMD.String("q", "", "the words to search for")
+	searchPage := searchCMD.Int("page", 1, "the page of results to show")
+	searchPageSize := searchCMD.Int("page-size", 10, "the number of results per page")
+
+	setRoleCMD := flag.NewFlagSet("set-role", flag.ExitOnError)
+	roleEmail := setRoleCMD.String("email", "", "the email address of the user")
+	role := setRoleCMD.String("role", "", "the new role of the user")
+
+	auditCMD := flag.NewFlagSet("audit", flag.ExitOnError)
+	since := auditCMD.String("since", "", "the first day to export, as YYYY-MM-DD")
+	until := auditCMD.String("until", "", "the last day to export, as YYYY-MM-DD")
+	format := auditCMD.String("format", "json", "the output format, json or csv")
+
+	config.RegisterFlags(flag.CommandLine)
 	setFlag(flag.CommandLine)
 	flag.Parse()
 
-	dns := fmt.Sprintf("%s:%s@/%s?parseTime=true", getEnvVar("DB_USERNAME"), getEnvVar("DB_PASSWORD"), getEnvVar("DB_DATABASE"))
-	db, err := openDB(dns)
+	cfg, err := config.Load(flag.CommandLine)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = cfg.Validate()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := openDB(cfg.DB.DriverName(), cfg.DB.DSN())
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
+	st := newStore(cfg.DB.Driver, db, cfg.QueryTimeout)
 
 	if strF != "" {
 		switch strF {
 		case "snippets":
-			sm := &mysql.SnippetModel{DB: db}
-			ss, err := sm.Latest()
+			if *page < 1 || *pageSize < 1 {
+				log.Fatal("-page and -page-size must be positive")
+			}
+			ss, total, err := st.snippets.List(context.Background(), *page, *pageSize)
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -75,20 +159,69 @@ func main() {
 				if err != nil {
 					log.Fatal(err)
 				}
-				fmt.Printf("Snippet %d: %+v \n", index, string(snippet))
+				fmt.Printf("Snippet %d: %+v \n", (*page-1)*(*pageSize)+index, string(snippet))
+			}
+			lastPage := (total + *pageSize - 1) / *pageSize
+			if lastPage == 0 {
+				lastPage = 1
 			}
+			fmt.Printf("Page %d of %d (%d snippets)\n", *page, lastPage, total)
 		case "users":
 			fmt.Print("Users selected")
 		default:
 			showHelp()
 		}
 	}
-	if len(os.Args) > 0 {
-		switch os.Args[1] {
+	// Subcommands follow the global flags, so that settings such as -config
+	// can be given before them.
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
 		case "get":
-			getCMD.Parse(os.Args[2:])
+			getCMD.Parse(args[1:])
 			if *model != "" && *id > 0 {
-				err = getModel(db, *model, *id)
+				err = getModel(st, *model, *id)
+				if err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				showHelp()
+			}
+		case "set-role":
+			setRoleCMD.Parse(args[1:])
+			if *roleEmail != "" && *role != "" {
+				err = setRole(st, *roleEmail, *role)
+				if err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				showHelp()
+			}
+		case "audit":
+			auditCMD.Parse(args[1:])
+			err = exportAudit(st, os.Stdout, *since, *until, *format)
+			if err != nil {
+				log.Fatal(err)
+			}
+		case "purge-expired":
+			infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+			n, err := st.snippets.DeleteExpired(context.Background())
+			if err != nil {
+				log.Fatal(err)
+			}
+			infoLog.Printf("Purged %d expired snippets", n)
+		case "migrate":
+			if len(args) < 2 {
+				showHelp()
+				break
+			}
+			err = migrate(&migrations.Migrator{DB: db, Driver: cfg.DB.Driver}, args[1])
+			if err != nil {
+				log.Fatal(err)
+			}
+		case "search":
+			searchCMD.Parse(args[1:])
+			if *q != "" && *searchPage > 0 && *searchPageSize > 0 {
+				err = searchSnippets(st, *q, *searchPage, *searchPageSize)
 				if err != nil {
 					log.Fatal(err)
 				}
@@ -103,8 +236,8 @@ func main() {
 	}
 }
 
-func openDB(dns string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dns)
+func openDB(driver, dns string) (*sql.DB, error) {
+	db, err := sql.Open(driver, dns)
 	if err != nil {
 		return nil, err
 	}
@@ -117,11 +250,10 @@ func openDB(dns string) (*sql.DB, error) {
 	return db, nil
 }
 
-func getModel(db *sql.DB, model string, id int) error {
+func getModel(st *store, model string, id int) error {
 	switch model {
 	case "user":
-		m := &mysql.UserModel{DB: db}
-		s, err := m.Get(id)
+		s, err := st.users.Get(context.Background(), id)
 		if err != nil {
 			return err
 		}
@@ -131,8 +263,7 @@ func getModel(db *sql.DB, model string, id int) error {
 		}
 		fmt.Printf("%+v \n", string(mo))
 	case "snippet":
-		m := &mysql.SnippetModel{DB: db}
-		s, err := m.Get(id)
+		s, err := st.snippets.Get(context.Background(), id)
 		if err != nil {
 			return err
 		}
@@ -144,3 +275,149 @@ func getModel(db *sql.DB, model string, id int) error {
 	}
 	return nil
 }
+
+func searchSnippets(st *store, q string, page, pageSize int) error {
+	ss, total, err := st.snippets.Search(context.Background(), q, page, pageSize)
+	if err != nil {
+		return err
+	}
+	for index, s := range ss {
+		snippet, err := json.MarshalIndent(s, "", "   ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Result %d: %+v \n", (page-1)*pageSize+index, string(snippet))
+	}
+	fmt.Printf("%d snippets matched %q\n", total, q)
+	return nil
+}
+
+// setRole changes the role of the user with the given email address. This is
+// how the first admin is made, since only admins can manage users in the web
+// interface. The change is recorded in the audit log without an actor.
+func setRole(st *store, email, role string) error {
+	valid := false
+	for _, r := range models.Roles {
+		valid = valid || r == role
+	}
+	if !valid {
+		return fmt.Errorf("unknown role %q, must be one of %s", role, strings.Join(models.Roles, ", "))
+	}
+
+	ctx := context.Background()
+	u, err := st.users.GetByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("finding user %s: %w", email, err)
+	}
+	if err = st.users.SetRole(ctx, u.ID, role); err != nil {
+		return err
+	}
+	err = st.audit.Insert(ctx, 0, "", "cli", "admin.user.role", fmt.Sprintf("user:%d role:%s", u.ID, role))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Changed the role of %s to %s\n", email, role)
+	return nil
+}
+
+// exportAudit writes the audit events from the day since to the day until,
+// both included, to w as a JSON array or as CSV. Either day can be empty to
+// leave that end of the range open.
+func exportAudit(st *store, w io.Writer, since, until, format string) error {
+	var from, to time.Time
+	var err error
+	if since != "" {
+		if from, err = time.Parse("2006-01-02", since); err != nil {
+			return fmt.Errorf("invalid -since: %w", err)
+		}
+	}
+	if until != "" {
+		if to, err = time.Parse("2006-01-02", until); err != nil {
+			return fmt.Errorf("invalid -until: %w", err)
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+
+	ctx := context.Background()
+	switch format {
+	case "json":
+		// Write the array one event at a time, so that a long export doesn't
+		// have to fit in memory.
+		sep := "["
+		err = st.audit.Export(ctx, from, to, func(e *models.AuditEvent) error {
+			js, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "%s\n%s", sep, js)
+			sep = ","
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if sep == "[" {
+			_, err = fmt.Fprintln(w, "[]")
+		} else {
+			_, err = fmt.Fprintln(w, "\n]")
+		}
+		return err
+	case "csv":
+		cw := csv.NewWriter(w)
+		err = cw.Write([]string{"ID", "Created", "Event", "Target", "ActorID", "ActorEmail", "IPAddress", "UserAgent"})
+		if err != nil {
+			return err
+		}
+		err = st.audit.Export(ctx, from, to, func(e *models.AuditEvent) error {
+			return cw.Write([]string{
+				strconv.Itoa(e.ID), e.Created.UTC().Format(time.RFC3339), e.Event, e.Target,
+				strconv.Itoa(e.ActorID), e.ActorEmail, e.IPAddress, e.UserAgent,
+			})
+		})
+		if err != nil {
+			return err
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown format %q, must be json or csv", format)
+	}
+}
+
+// migrate runs one of the migrate subcommands: up, down or status.
+func migrate(m *migrations.Migrator, command string) error {
+	switch command {
+	case "up":
+		done, err := m.Up()
+		for _, mg := range done {
+			fmt.Printf("Applied %04d_%s\n", mg.Version, mg.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Println("No pending migrations")
+		}
+	case "down":
+		mg, err := m.Down()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted %04d_%s\n", mg.Version, mg.Name)
+	case "status":
+		status, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q, must be up, down or status", command)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+)
+
+// auditStub keeps audit events in memory and filters them the same way as
+// the database models: since is inclusive, until is exclusive and a zero time
+// leaves that end of the range open.
+type auditStub []*models.AuditEvent
+
+func (s auditStub) Insert(ctx context.Context, actorID int, ipAddress, userAgent, event, target string) error {
+	return errors.New("not implemented")
+}
+
+func (s auditStub) Export(ctx context.Context, since, until time.Time, fn func(*models.AuditEvent) error) error {
+	for _, e := range s {
+		if (!since.IsZero() && e.Created.Before(since)) || (!until.IsZero() && !e.Created.Before(until)) {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var testAuditEvents = auditStub{
+	{ID: 1, ActorID: 1, ActorEmail: "alice@example.com", IPAddress: "192.0.2.1", UserAgent: "Mozilla/5.0",
+		Event: "user.login", Target: "user:1", Created: time.Date(2021, 4, 1, 10, 0, 0, 0, time.UTC)},
+	{ID: 2, IPAddress: "192.0.2.2", UserAgent: "curl/7.0, \"quoted\"",
+		Event: "user.login.failure", Target: "email:bob@example.com", Created: time.Date(2021, 4, 2, 0, 0, 0, 0, time.UTC)},
+	{ID: 3, ActorID: 1, ActorEmail: "alice@example.com", IPAddress: "192.0.2.1", UserAgent: "Mozilla/5.0",
+		Event: "user.logout", Target: "user:1", Created: time.Date(2021, 4, 2, 23, 59, 59, 0, time.UTC)},
+}
+
+func TestExportAudit(t *testing.T) {
+	st := &store{audit: testAuditEvents}
+
+	tests := []struct {
+		name    string
+		since   string
+		until   string
+		wantIDs []int
+	}{
+		{"Everything", "", "", []int{1, 2, 3}},
+		{"Since is inclusive", "2021-04-02", "", []int{2, 3}},
+		{"Until covers the whole day", "", "2021-04-02", []int{1, 2, 3}},
+		{"Until excludes the next day", "", "2021-04-01", []int{1}},
+		{"Single day", "2021-04-02", "2021-04-02", []int{2, 3}},
+		{"Empty range", "2021-04-03", "", []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" JSON", func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := exportAudit(st, &buf, tt.since, tt.until, "json"); err != nil {
+				t.Fatal(err)
+			}
+
+			var events []*models.AuditEvent
+			if err := json.Unmarshal(buf.Bytes(), &events); err != nil {
+				t.Fatalf("want valid JSON; got %v in %s", err, buf.Bytes())
+			}
+			if events == nil {
+				t.Fatalf("want an array; got %s", buf.Bytes())
+			}
+			if len(events) != len(tt.wantIDs) {
+				t.Fatalf("want %d events; got %d", len(tt.wantIDs), len(events))
+			}
+			for i, e := range events {
+				want := *testAuditEvents[tt.wantIDs[i]-1]
+				if !e.Created.Equal(want.Created) {
+					t.Errorf("want created %v; got %v", want.Created, e.Created)
+				}
+				e.Created = want.Created
+				if !reflect.DeepEqual(*e, want) {
+					t.Errorf("want event %+v; got %+v", want, *e)
+				}
+			}
+		})
+
+		t.Run(tt.name+" CSV", func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := exportAudit(st, &buf, tt.since, tt.until, "csv"); err != nil {
+				t.Fatal(err)
+			}
+
+			records, err := csv.NewReader(&buf).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantHeader := []string{"ID", "Created", "Event", "Target", "ActorID", "ActorEmail", "IPAddress", "UserAgent"}
+			if len(records) == 0 || !reflect.DeepEqual(records[0], wantHeader) {
+				t.Fatalf("want header %q; got %q", wantHeader, records)
+			}
+			if len(records)-1 != len(tt.wantIDs) {
+				t.Fatalf("want %d rows; got %d", len(tt.wantIDs), len(records)-1)
+			}
+			for i, row := range records[1:] {
+				e := testAuditEvents[tt.wantIDs[i]-1]
+				want := []string{
+					strconv.Itoa(e.ID), e.Created.Format(time.RFC3339), e.Event, e.Target,
+					strconv.Itoa(e.ActorID), e.ActorEmail, e.IPAddress, e.UserAgent,
+				}
+				if !reflect.DeepEqual(row, want) {
+					t.Errorf("want row %q; got %q", want, row)
+				}
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := exportAudit(st, &buf, "2021-04-03", "", "json"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[]\n" {
+		t.Errorf("want an empty export to be %q; got %q", "[]\n", buf.String())
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestExportAuditErrors(t *testing.T) {
+	st := &store{audit: testAuditEvents}
+
+	tests := []struct {
+		name   string
+		since  string
+		until  string
+		format string
+	}{
+		{"Invalid since", "01/04/2021", "", "json"},
+		{"Invalid until", "", "2021-04-31", "csv"},
+		{"Unknown format", "", "", "xml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := exportAudit(st, &buf, tt.since, tt.until, tt.format); err == nil {
+				t.Error("want an error; got nil")
+			}
+			if buf.Len() != 0 {
+				t.Errorf("want nothing written; got %q", buf.String())
+			}
+		})
+	}
+
+	for _, format := range []string{"json", "csv"} {
+		t.Run("Write error "+format, func(t *testing.T) {
+			if err := exportAudit(st, failingWriter{}, "", "", format); err == nil {
+				t.Error("want an error; got nil")
+			}
+		})
+	}
+}
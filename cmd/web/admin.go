@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/forms"
+	"wilbertopachecob/snippetbox/pkg/models"
+)
+
+// The number of users and audit events shown on each page of the admin
+// listings.
+const (
+	usersPageSize = 20
+	auditPageSize = 50
+)
+
+// auditDateLayout is the format of the since and until filters of the audit
+// log. Both are days in UTC.
+const auditDateLayout = "2006-01-02"
+
+// adminUsers lists the users, optionally only those whose name or email
+// address contains the "q" query string parameter.
+func (app *application) adminUsers(w http.ResponseWriter, r *http.Request) {
+	page, err := pageParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	users, total, err := app.users.List(r.Context(), q, page, usersPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	p := &pagination{Page: page, PageSize: usersPageSize, Total: total}
+	if page > p.LastPage() {
+		app.notFound(w)
+		return
+	}
+
+	app.render(w, r, "admin.page.tmpl", &templateData{
+		Query:      q,
+		Users:      users,
+		Pagination: p,
+	})
+}
+
+func (app *application) adminDisableUser(w http.ResponseWriter, r *http.Request) {
+	app.setUserDisabled(w, r, true)
+}
+
+func (app *application) adminEnableUser(w http.ResponseWriter, r *http.Request) {
+	app.setUserDisabled(w, r, false)
+}
+
+// setUserDisabled disables or enables the user given by the ":id" URL
+// parameter. Disabling a user also logs them out everywhere. Admins can't
+// disable themselves, so that there is always somebody left to undo it.
+func (app *application) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+	admin := app.authenticatedUser(r)
+	if id == admin.ID {
+		app.session.Put(r, "flash", "You can't disable your own account")
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	err = app.users.SetDisabled(r.Context(), id, disabled)
+	if err != nil {
+		if err == models.ErrNoRecord {
+			app.notFound(w)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	event, flash := "admin.user.enable", "The account has been enabled"
+	if disabled {
+		if _, err = app.sessionStore.DeleteAll(r.Context(), id); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		event, flash = "admin.user.disable", "The account has been disabled"
+	}
+	app.recordEvent(r, admin.ID, event, fmt.Sprintf("user:%d", id))
+
+	app.session.Put(r, "flash", flash)
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// adminDeleteSnippet lets moderators delete a snippet of any user.
+func (app *application) adminDeleteSnippet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	err = app.snippets.Delete(r.Context(), id)
+	if err != nil {
+		if err == models.ErrNoRecord {
+			app.notFound(w)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+	app.recordEvent(r, app.authenticatedUser(r).ID, "admin.snippet.delete", fmt.Sprintf("snippet:%d", id))
+
+	app.session.Put(r, "flash", "The Snippet was deleted successfuly")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// adminAudit lists the audit log, newest first. The "since" and "until"
+// query string parameters limit it to a range of days, including both.
+func (app *application) adminAudit(w http.ResponseWriter, r *http.Request) {
+	page, err := pageParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	f := forms.New(r.URL.Query())
+	since := parseDay(f, "since")
+	until := parseDay(f, "until")
+	if !f.Valid() {
+		app.render(w, r, "audit.page.tmpl", &templateData{Form: f})
+		return
+	}
+	if !until.IsZero() {
+		until = until.AddDate(0, 0, 1)
+	}
+
+	events, total, err := app.audit.List(r.Context(), since, until, page, auditPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, "audit.page.tmpl", &templateData{
+		Form:        f,
+		AuditEvents: events,
+		Pagination:  &pagination{Page: page, PageSize: auditPageSize, Total: total},
+	})
+}
+
+// parseDay parses the given field of the form as a day in UTC. It returns the
+// zero time if the field is empty, or adds an error to the form if it isn't a
+// valid day.
+func parseDay(f *forms.Form, field string) time.Time {
+	v := strings.TrimSpace(f.Get(field))
+	if v == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(auditDateLayout, v)
+	if err != nil {
+		f.Errors.Add(field, "This field must be a date such as 2021-04-01")
+		return time.Time{}
+	}
+	return t
+}
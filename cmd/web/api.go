@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/forms"
+	"wilbertopachecob/snippetbox/pkg/models"
+)
+
+// apiSnippet is the JSON representation of a snippet returned by the API.
+type apiSnippet struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	Author     string    `json:"author"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Language   string    `json:"language"`
+	Visibility string    `json:"visibility"`
+	Slug       string    `json:"slug,omitempty"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+}
+
+func newAPISnippet(s *models.Snippet) *apiSnippet {
+	return &apiSnippet{
+		ID:         s.ID,
+		UserID:     s.UserID,
+		Author:     s.Author,
+		Title:      s.Title,
+		Content:    s.Content,
+		Language:   s.Language,
+		Visibility: s.Visibility,
+		Slug:       s.Slug,
+		Created:    s.Created,
+		Expires:    s.Expires,
+	}
+}
+
+// requiredAPIAuthenticated is the JSON API counterpart of the
+// requiredAuthenticated middleware. Instead of redirecting to the login page
+// it responds with a 401 Unauthorized error.
+func (app *application) requiredAPIAuthenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.authenticatedUser(r) == nil {
+			app.apiClientError(w, http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) apiListSnippets(w http.ResponseWriter, r *http.Request) {
+	page, err := pageParam(r)
+	if err != nil {
+		app.writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+
+	snippets, total, err := app.snippets.List(r.Context(), page, snippetsPageSize)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	data := make([]*apiSnippet, 0, len(snippets))
+	for _, s := range snippets {
+		data = append(data, newAPISnippet(s))
+	}
+	app.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"snippets": data,
+		"metadata": map[string]int{
+			"page":      page,
+			"page_size": snippetsPageSize,
+			"total":     total,
+		},
+	})
+}
+
+func (app *application) apiShowSnippet(w http.ResponseWriter, r *http.Request) {
+	ID, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || ID <= 0 {
+		app.apiClientError(w, http.StatusNotFound)
+		return
+	}
+
+	s, err := app.snippets.Get(r.Context(), ID)
+	if err == models.ErrNoRecord {
+		app.apiClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	if !canView(s, app.authenticatedUser(r), false) {
+		app.apiClientError(w, http.StatusNotFound)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, map[string]interface{}{"snippet": newAPISnippet(s)})
+}
+
+func (app *application) apiCreateSnippet(w http.ResponseWriter, r *http.Request) {
+	// Only accept JSON bodies. Besides keeping the API honest, this means a
+	// browser can't submit to this endpoint from a plain HTML form on another
+	// site, which matters because this chain doesn't use the CSRF middleware.
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		app.apiClientError(w, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var input struct {
+		Title      string `json:"title"`
+		Content    string `json:"content"`
+		Language   string `json:"language"`
+		Visibility string `json:"visibility"`
+		Expires    int    `json:"expires"`
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&input)
+	if err != nil {
+		app.writeJSON(w, http.StatusBadRequest, apiError{Error: fmt.Sprintf("invalid JSON body: %s", err)})
+		return
+	}
+
+	// Copy the input into a forms.Form so that we can reuse the same
+	// validation rules as the HTML create snippet form.
+	form := forms.New(url.Values{})
+	form.Set("title", input.Title)
+	form.Set("content", input.Content)
+	form.Set("language", input.Language)
+	if input.Language == "" {
+		form.Set("language", "plaintext")
+	}
+	form.Set("visibility", input.Visibility)
+	if input.Visibility == "" {
+		form.Set("visibility", models.VisibilityPublic)
+	}
+	form.Set("expires", strconv.Itoa(input.Expires))
+	validateSnippetForm(form, "1", "7", "365")
+
+	if !form.Valid() {
+		app.writeJSON(w, http.StatusUnprocessableEntity, apiError{
+			Error:  "validation failed",
+			Fields: form.Errors,
+		})
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	ID, err := app.snippets.Insert(r.Context(), user.ID, form.Get("title"), form.Get("content"), form.Get("language"), form.Get("visibility"), form.Get("expires"))
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	app.recordEvent(r, user.ID, "snippet.create", fmt.Sprintf("snippet:%d", ID))
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/snippets/%d", ID))
+	app.writeJSON(w, http.StatusCreated, map[string]interface{}{"id": ID})
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+// postJSON sends a POST request with a JSON body to the test server and
+// returns the response status code, headers and body.
+func (tls *testServer) postJSON(t *testing.T, URL string, body string) (int, http.Header, []byte) {
+	rs, err := tls.Client().Post(tls.URL+URL, "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rb, err := ioutil.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+	return rs.StatusCode, rs.Header, rb
+}
+
+func TestAPIListSnippets(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	code, header, body := tls.get(t, "/api/v1/snippets")
+	if code != http.StatusOK {
+		t.Errorf("want %d; got %d", http.StatusOK, code)
+	}
+	if ct := header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("want %q; got %q", "application/json", ct)
+	}
+
+	var resp struct {
+		Snippets []apiSnippet `json:"snippets"`
+	}
+	err := json.Unmarshal(body, &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Snippets) != 1 || resp.Snippets[0].Title != "An old silent pond" {
+		t.Errorf("unexpected snippets %+v", resp.Snippets)
+	}
+
+	code, _, body = tls.get(t, "/api/v1/snippets?page=2")
+	if code != http.StatusOK {
+		t.Errorf("want %d; got %d", http.StatusOK, code)
+	}
+	if !bytes.Contains(body, []byte(`"snippets":[]`)) {
+		t.Errorf("want an empty page; got %s", body)
+	}
+
+	code, _, _ = tls.get(t, "/api/v1/snippets?page=-1")
+	if code != http.StatusBadRequest {
+		t.Errorf("want %d; got %d", http.StatusBadRequest, code)
+	}
+}
+
+func TestAPIShowSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Valid ID", "/api/v1/snippets/1", http.StatusOK, []byte(`"content":"An old silent pond..."`)},
+		{"Non-existent ID", "/api/v1/snippets/2", http.StatusNotFound, []byte(`{"error":"Not Found"}`)},
+		{"Negative ID", "/api/v1/snippets/-1", http.StatusNotFound, []byte(`{"error":"Not Found"}`)},
+		{"String ID", "/api/v1/snippets/foo", http.StatusNotFound, []byte(`{"error":"Not Found"}`)},
+		{"Query timeout", "/api/v1/snippets/7", http.StatusServiceUnavailable, []byte(`{"error":"Service Unavailable"}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := tls.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAPICreateSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	code, _, body := tls.postJSON(t, "/api/v1/snippets", `{"title":"Title","content":"Content","expires":7}`)
+	if code != http.StatusUnauthorized {
+		t.Errorf("want %d; got %d", http.StatusUnauthorized, code)
+	}
+	if !bytes.Contains(body, []byte(`{"error":"Unauthorized"}`)) {
+		t.Errorf("want a JSON error body; got %s", body)
+	}
+
+	tls.login(t, "admin@gmail.com", "validPa$$word")
+
+	tests := []struct {
+		name         string
+		body         string
+		wantCode     int
+		wantLocation string
+		wantBody     []byte
+	}{
+		{"Valid submission", `{"title":"Title","content":"Content","expires":7}`, http.StatusCreated, "/api/v1/snippets/2", []byte(`{"id":2}`)},
+		{"Empty title", `{"content":"Content","expires":7}`, http.StatusUnprocessableEntity, "", []byte(`"title":["This field can not be empty"]`)},
+		{"Explicit language", `{"title":"Title","content":"Content","language":"go","expires":7}`, http.StatusCreated, "/api/v1/snippets/2", []byte(`{"id":2}`)},
+		{"Invalid language", `{"title":"Title","content":"Content","language":"cobol","expires":7}`, http.StatusUnprocessableEntity, "", []byte(`"language":["This field is invalid"]`)},
+		{"Invalid expires", `{"title":"Title","content":"Content","expires":2}`, http.StatusUnprocessableEntity, "", []byte(`"expires":["This field is invalid"]`)},
+		{"Malformed JSON", `{"title":`, http.StatusBadRequest, "", []byte(`"error":"invalid JSON body`)},
+		{"Unknown field", `{"name":"Title"}`, http.StatusBadRequest, "", []byte(`"error":"invalid JSON body`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := tls.postJSON(t, "/api/v1/snippets", tt.body)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, loc)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAPIBearerToken(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantCode      int
+	}{
+		{"Valid token", "Bearer valid-token", http.StatusCreated},
+		{"Lowercase scheme", "bearer valid-token", http.StatusCreated},
+		{"Unknown token", "Bearer wrong-token", http.StatusUnauthorized},
+		{"Wrong scheme", "Basic valid-token", http.StatusUnauthorized},
+		{"No header", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := bytes.NewBufferString(`{"title":"Title","content":"Content","expires":7}`)
+			req, err := http.NewRequest("POST", tls.URL+"/api/v1/snippets", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rs, err := tls.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, rs.StatusCode)
+			}
+		})
+	}
+}
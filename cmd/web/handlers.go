@@ -2,14 +2,19 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"html/template"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 	"wilbertopachecob/snippetbox/pkg/forms"
 	"wilbertopachecob/snippetbox/pkg/models"
+	"wilbertopachecob/snippetbox/pkg/totp"
 
 	"github.com/justinas/nosurf"
 )
@@ -45,7 +50,7 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, page stri
 	// provided name, call the serverError helper method that we made earlier.
 	ts, ok := app.templateCache[page]
 	if !ok {
-		app.serverError(w, fmt.Errorf("the template %s does not exist", page))
+		app.serverError(w, r, fmt.Errorf("the template %s does not exist", page))
 		return
 	}
 	// Initialize a new buffer.
@@ -55,7 +60,7 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, page stri
 	// return.
 	err := ts.Execute(buf, app.addDefaultData(data, r))
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -74,13 +79,25 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	// 	return
 	// }
 
-	snippets, err := app.snippets.Latest()
+	page, err := pageParam(r)
 	if err != nil {
-		app.serverError(w, err)
+		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	data := &templateData{Snippets: snippets}
+	snippets, total, err := app.snippets.List(r.Context(), page, snippetsPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	p := &pagination{Page: page, PageSize: snippetsPageSize, Total: total}
+	if page > p.LastPage() {
+		app.notFound(w)
+		return
+	}
+
+	data := &templateData{Snippets: snippets, Pagination: p}
 	// Working Directory
 	// dir := getExecutablePath()
 
@@ -90,12 +107,12 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	// 	dir + "/ui/html/base.layout.tmpl"}
 	// ts, err := template.ParseFiles(files...)
 	// if err != nil {
-	// 	app.serverError(w, err)
+	// 	app.serverError(w, r, err)
 	// 	return
 	// }
 	// err = ts.Execute(w, data)
 	// if err != nil {
-	// 	app.serverError(w, err)
+	// 	app.serverError(w, r, err)
 	// 	return
 	// }
 
@@ -111,12 +128,20 @@ func (app *application) showSnippet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s, err := app.snippets.Get(ID)
+	s, err := app.snippets.Get(r.Context(), ID)
 	if err == models.ErrNoRecord {
 		app.notFound(w)
 		return
 	} else if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Unlisted snippets can only be reached by their slug, so that they can't
+	// be found by guessing ids. We respond with a 404 rather than a 403 so as
+	// not to give away that the snippet exists.
+	if !canView(s, app.authenticatedUser(r), false) {
+		app.notFound(w)
 		return
 	}
 
@@ -133,16 +158,60 @@ func (app *application) showSnippet(w http.ResponseWriter, r *http.Request) {
 
 	// ts, err := template.ParseFiles(files...)
 	// if err != nil {
-	// 	app.serverError(w, err)
+	// 	app.serverError(w, r, err)
 	// 	return
 	// }
 	// err = ts.Execute(w, data)
 	// if err != nil {
-	// 	app.serverError(w, err)
+	// 	app.serverError(w, r, err)
 	// 	return
 	// }
 }
 
+func (app *application) showUnlistedSnippet(w http.ResponseWriter, r *http.Request) {
+	s, err := app.snippets.GetBySlug(r.Context(), r.URL.Query().Get(":slug"))
+	if err == models.ErrNoRecord {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !canView(s, app.authenticatedUser(r), true) {
+		app.notFound(w)
+		return
+	}
+
+	app.render(w, r, "show.page.tmpl", &templateData{Snippet: s})
+}
+
+func (app *application) search(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		app.render(w, r, "search.page.tmpl", &templateData{})
+		return
+	}
+
+	page, err := pageParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippets, total, err := app.snippets.Search(r.Context(), q, page, snippetsPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, "search.page.tmpl", &templateData{
+		Query:      q,
+		Snippets:   snippets,
+		Pagination: &pagination{Page: page, PageSize: snippetsPageSize, Total: total},
+	})
+}
+
 func (app *application) createSnippetForm(w http.ResponseWriter, r *http.Request) {
 	// app.render("create.page.tmpl", w, nil, r)
 	app.render(w, r, "create.page.tmpl", &templateData{
@@ -204,10 +273,7 @@ func (app *application) createSnippet(w http.ResponseWriter, r *http.Request) {
 	// }
 
 	form := forms.New(r.PostForm)
-
-	form.Required("title", "content", "expires")
-	form.MaxLength("title", 100)
-	form.PermitedValues("expires", "1", "7", "365")
+	validateSnippetForm(form, "1", "7", "365")
 
 	if !form.Valid() {
 		app.render(w, r, "create.page.tmpl", &templateData{
@@ -216,11 +282,15 @@ func (app *application) createSnippet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ID, err := app.snippets.Insert(form.Get("title"), form.Get("content"), form.Get("expires"))
+	// The requiredAuthenticated middleware guarantees there is a user in the
+	// request context, so we can record them as the snippet's author.
+	user := app.authenticatedUser(r)
+	ID, err := app.snippets.Insert(r.Context(), user.ID, form.Get("title"), form.Get("content"), form.Get("language"), form.Get("visibility"), form.Get("expires"))
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
+	app.recordEvent(r, user.ID, "snippet.create", fmt.Sprintf("snippet:%d", ID))
 
 	// Use the Put() method to add a string value ("Your snippet was saved
 	// successfully!") and the corresponding key ("flash") to the session
@@ -232,6 +302,120 @@ func (app *application) createSnippet(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, fmt.Sprintf("/snippet/%d", ID), http.StatusSeeOther)
 }
 
+// keepExpiry is the value of the expires field of the edit snippet form that
+// leaves the snippet's expiry as it is.
+const keepExpiry = "keep"
+
+// validateSnippetForm runs the checks shared by the create and edit snippet
+// forms. expires lists the values the expires field may take.
+func validateSnippetForm(form *forms.Form, expires ...string) {
+	form.Required("title", "content", "language", "visibility", "expires")
+	form.MaxLength("title", 100)
+	form.PermitedValues("language", languageNames()...)
+	form.PermitedValues("visibility", models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate)
+	form.PermitedValues("expires", expires...)
+}
+
+// ownedSnippet fetches the snippet identified by the ":id" URL parameter and
+// checks that it belongs to the authenticated user. If it doesn't, the
+// appropriate error response is sent and ok is false.
+func (app *application) ownedSnippet(w http.ResponseWriter, r *http.Request) (s *models.Snippet, ok bool) {
+	ID, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || ID <= 0 {
+		app.notFound(w)
+		return nil, false
+	}
+
+	s, err = app.snippets.Get(r.Context(), ID)
+	if err == models.ErrNoRecord {
+		app.notFound(w)
+		return nil, false
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return nil, false
+	}
+
+	if s.UserID != app.authenticatedUser(r).ID {
+		app.clientError(w, http.StatusForbidden)
+		return nil, false
+	}
+	return s, true
+}
+
+func (app *application) editSnippetForm(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	form := forms.New(url.Values{})
+	form.Set("title", s.Title)
+	form.Set("content", s.Content)
+	form.Set("language", s.Language)
+	form.Set("visibility", s.Visibility)
+	form.Set("expires", keepExpiry)
+
+	app.render(w, r, "edit.page.tmpl", &templateData{
+		Snippet: s,
+		Form:    form,
+	})
+}
+
+func (app *application) editSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	validateSnippetForm(form, keepExpiry, "1", "7", "365")
+
+	if !form.Valid() {
+		app.render(w, r, "edit.page.tmpl", &templateData{
+			Snippet: s,
+			Form:    form,
+		})
+		return
+	}
+
+	expires := form.Get("expires")
+	if expires == keepExpiry {
+		expires = ""
+	}
+	err = app.snippets.Update(r.Context(), s.ID, form.Get("title"), form.Get("content"), form.Get("language"), form.Get("visibility"), expires)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.recordEvent(r, s.UserID, "snippet.update", fmt.Sprintf("snippet:%d", s.ID))
+
+	app.session.Put(r, "flash", "The Snippet was updated successfuly")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/%d", s.ID), http.StatusSeeOther)
+}
+
+func (app *application) deleteSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.Delete(r.Context(), s.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.recordEvent(r, s.UserID, "snippet.delete", fmt.Sprintf("snippet:%d", s.ID))
+
+	app.session.Put(r, "flash", "The Snippet was deleted successfuly")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
 func (app *application) signupUserForm(w http.ResponseWriter, r *http.Request) {
 	app.render(w, r, "signup.page.tmpl", &templateData{
 		Form: forms.New(nil),
@@ -240,7 +424,7 @@ func (app *application) signupUserForm(w http.ResponseWriter, r *http.Request) {
 func (app *application) signupUser(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 	}
 
 	f := forms.New(r.PostForm)
@@ -255,7 +439,7 @@ func (app *application) signupUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.users.Insert(f.Get("name"), f.Get("email"), f.Get("password"))
+	id, err := app.users.Insert(r.Context(), f.Get("name"), f.Get("email"), f.Get("password"))
 	if err != nil {
 		if err == models.ErrDuplicateEmail {
 			f.Errors.Add("email", "This email already exist on the DB")
@@ -264,9 +448,10 @@ func (app *application) signupUser(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
+	app.recordEvent(r, id, "user.signup", fmt.Sprintf("user:%d", id))
 
 	app.session.Put(r, "flash", "Your signup was successful. Please log in.")
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
@@ -278,6 +463,9 @@ func (app *application) loginUserForm(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// loginFailedMessage is shown for every failed login.
+const loginFailedMessage = "Incorrect email or password, or the account is temporarily locked"
+
 func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
@@ -295,33 +483,593 @@ func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := app.users.Authenticate(f.Get("email"), f.Get("password"))
+	id, err := app.users.Authenticate(r.Context(), f.Get("email"), f.Get("password"))
 	if err != nil {
-		if err == models.ErrNoRecord {
-			f.Errors.Add("generic", "There is no user on the DB with the provided email")
+		// Use the same message whether the email is unknown, the password
+		// is wrong or the account is locked, so that the form can't be used
+		// to find out which email addresses have an account.
+		if err == models.ErrNoRecord || err == models.ErrInvalidCredentials || err == models.ErrAccountLocked {
+			app.metrics.logins.Inc("failure")
+			app.recordEvent(r, 0, "user.login.failure", "email:"+f.Get("email"))
+			f.Errors.Add("generic", loginFailedMessage)
 			app.render(w, r, "login.page.tmpl", &templateData{Form: f})
 			return
-		} else if err == models.ErrInvalidCredentials {
-			f.Errors.Add("generic", "Please verify the provided password")
+		}
+		if err == models.ErrAccountDisabled {
+			app.metrics.logins.Inc("failure")
+			app.recordEvent(r, 0, "user.login.failure", "email:"+f.Get("email"))
+			f.Errors.Add("generic", "Your account has been disabled")
 			app.render(w, r, "login.page.tmpl", &templateData{Form: f})
 			return
 		}
-		app.serverError(w, err)
+		app.serverError(w, r, err)
+		return
+	}
+	// Users with two-factor authentication enabled have to enter a code
+	// before they are logged in. Until then the session only remembers who
+	// they said they are.
+	secret, err := app.twoFactor.Secret(r.Context(), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if secret != "" {
+		app.session.Put(r, "pendingUserID", id)
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	app.completeLogin(w, r, id)
+}
+
+// completeLogin logs the user in once they have passed every step of the
+// login.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, id int) {
+	// Record the login on the server, and keep the token naming it in the
+	// cookie. The server-side session lasts as long as the cookie.
+	token, err := app.sessionStore.Insert(r.Context(), id, clientIP(r), r.UserAgent(), app.session.Lifetime)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 	// Add the ID of the current user to the session, so that they are now 'logg
 	// in'.
+	app.session.Remove(r, "pendingUserID")
+	app.session.Put(r, "sessionToken", token)
 	app.session.Put(r, "userID", id)
+	app.metrics.logins.Inc("success")
+	app.metrics.sessions.Inc("started")
+	app.recordEvent(r, id, "user.login", fmt.Sprintf("user:%d", id))
 	// Redirect the user to the create snippet page.
 	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
 }
 
-func (app *application) logout(w http.ResponseWriter, r *http.Request) {
+// checkSecondFactor checks a code entered by a user with two-factor
+// authentication enabled. Codes of 6 digits come from their authenticator
+// app, anything else is taken to be one of their recovery codes.
+func (app *application) checkSecondFactor(ctx context.Context, userID int, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits && strings.Trim(code, "0123456789") == "" {
+		return app.twoFactor.Verify(ctx, userID, code)
+	}
+	return app.twoFactor.UseRecoveryCode(ctx, userID, code)
+}
+
+func (app *application) verifyLoginForm(w http.ResponseWriter, r *http.Request) {
+	if !app.session.Exists(r, "pendingUserID") {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+	app.render(w, r, "verify.page.tmpl", &templateData{
+		Form: forms.New(nil),
+	})
+}
+
+func (app *application) verifyLogin(w http.ResponseWriter, r *http.Request) {
+	id := app.session.GetInt(r, "pendingUserID")
+	if id == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	f := forms.New(r.PostForm)
+	f.Required("code")
+	if !f.Valid() {
+		app.render(w, r, "verify.page.tmpl", &templateData{Form: f})
+		return
+	}
+
+	err = app.checkSecondFactor(r.Context(), id, f.Get("code"))
+	if err != nil {
+		if err == models.ErrInvalidCredentials || err == models.ErrNoRecord {
+			app.metrics.logins.Inc("failure")
+			app.recordEvent(r, 0, "user.login.failure", fmt.Sprintf("user:%d", id))
+			f.Errors.Add("generic", "The code is not valid")
+			app.render(w, r, "verify.page.tmpl", &templateData{Form: f})
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.completeLogin(w, r, id)
+}
+
+func (app *application) accountPage(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	f := forms.New(url.Values{})
+	f.Set("name", user.Name)
+	f.Set("email", user.Email)
+	app.render(w, r, "account.page.tmpl", &templateData{Form: f})
+}
+
+func (app *application) updateAccount(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	f := forms.New(r.PostForm)
+	f.Required("name", "email")
+	f.MaxLength("name", 255)
+	f.MatchesPattern("email", forms.EmailRX)
+
+	if !f.Valid() {
+		app.render(w, r, "account.page.tmpl", &templateData{Form: f})
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	err = app.users.UpdateProfile(r.Context(), user.ID, f.Get("name"), f.Get("email"))
+	if err != nil {
+		if err == models.ErrDuplicateEmail {
+			f.Errors.Add("email", "This email already exist on the DB")
+			app.render(w, r, "account.page.tmpl", &templateData{Form: f})
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+	app.recordEvent(r, user.ID, "user.update", fmt.Sprintf("user:%d", user.ID))
+
+	app.session.Put(r, "flash", "Your account has been updated")
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+func (app *application) changePasswordForm(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, "password.page.tmpl", &templateData{
+		Form: forms.New(nil),
+	})
+}
+
+func (app *application) changePassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	f := forms.New(r.PostForm)
+	f.Required("current_password", "password", "confirm_password")
+	f.MinLength("password", 10)
+	if f.Get("password") != f.Get("confirm_password") {
+		f.Errors.Add("confirm_password", "The passwords don't match")
+	}
+
+	if !f.Valid() {
+		app.render(w, r, "password.page.tmpl", &templateData{Form: f})
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	err = app.users.ChangePassword(r.Context(), user.ID, f.Get("current_password"), f.Get("password"))
+	if err != nil {
+		if err == models.ErrInvalidCredentials {
+			f.Errors.Add("current_password", "Your current password is not correct")
+			app.render(w, r, "password.page.tmpl", &templateData{Form: f})
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+	app.recordEvent(r, user.ID, "user.password.change", fmt.Sprintf("user:%d", user.ID))
+
+	app.session.Put(r, "flash", "Your password has been changed")
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// endSession logs the user out of this browser by removing the user and the
+// session token from the cookie.
+func (app *application) endSession(r *http.Request) {
+	if app.session.Exists(r, "userID") {
+		app.metrics.sessions.Inc("ended")
+	}
 	app.session.Remove(r, "userID")
+	app.session.Remove(r, "sessionToken")
+}
+
+func (app *application) sessionsPage(w http.ResponseWriter, r *http.Request) {
+	sessions, err := app.sessionStore.List(r.Context(), app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	// Requests authenticated with an API token have no session of their own.
+	td := &templateData{Sessions: sessions}
+	if s := app.currentSession(r); s != nil {
+		td.CurrentSessionID = s.ID
+	}
+	app.render(w, r, "sessions.page.tmpl", td)
+}
+
+func (app *application) revokeSession(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	err = app.sessionStore.Delete(r.Context(), user.ID, id)
+	if err != nil {
+		if err == models.ErrNoRecord {
+			app.notFound(w)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+	app.recordEvent(r, user.ID, "session.revoke", fmt.Sprintf("session:%d", id))
+
+	if s := app.currentSession(r); s != nil && s.ID == id {
+		app.endSession(r)
+		app.session.Put(r, "flash", "You have been logout successfully")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+	app.session.Put(r, "flash", "The session has been signed out")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+// revokeAllSessions signs the user out everywhere, including this browser.
+func (app *application) revokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	_, err := app.sessionStore.DeleteAll(r.Context(), user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.recordEvent(r, user.ID, "session.revoke_all", fmt.Sprintf("user:%d", user.ID))
+	app.endSession(r)
+	app.session.Put(r, "flash", "You have been signed out everywhere")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// twoFactorIssuer names the application in authenticator apps.
+const twoFactorIssuer = "Snippetbox"
+
+// twoFactorPage shows whether two-factor authentication is enabled. If it
+// isn't, it shows a new secret for the user to add to their authenticator
+// app. The secret is kept in the session until the user enters a code
+// generated from it, which proves it was added correctly.
+func (app *application) twoFactorPage(w http.ResponseWriter, r *http.Request) {
+	app.renderTwoFactor(w, r, &templateData{Form: forms.New(nil)})
+}
+
+// renderTwoFactor renders the two-factor authentication settings page, filling
+// in the state of the authenticated user.
+func (app *application) renderTwoFactor(w http.ResponseWriter, r *http.Request, td *templateData) {
+	user := app.authenticatedUser(r)
+	secret, err := app.twoFactor.Secret(r.Context(), user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if secret != "" {
+		td.TwoFactorEnabled = true
+		td.RecoveryCodesLeft, err = app.twoFactor.RecoveryCodesLeft(r.Context(), user.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.render(w, r, "twofactor.page.tmpl", td)
+		return
+	}
+
+	pending := app.session.GetString(r, "totpSecret")
+	if pending == "" {
+		pending, err = totp.GenerateSecret()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.session.Put(r, "totpSecret", pending)
+	}
+	td.TOTPSecret = pending
+	td.TOTPURI = template.URL(totp.URI(twoFactorIssuer, user.Email, pending))
+	app.render(w, r, "twofactor.page.tmpl", td)
+}
+
+func (app *application) enableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	f := forms.New(r.PostForm)
+	f.Required("code")
+
+	pending := app.session.GetString(r, "totpSecret")
+	if pending == "" {
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return
+	}
+	if f.Valid() {
+		if _, ok := totp.Validate(pending, f.Get("code"), time.Now()); !ok {
+			f.Errors.Add("code", "The code is not valid. Check the time on your device is correct")
+		}
+	}
+	if !f.Valid() {
+		app.renderTwoFactor(w, r, &templateData{Form: f})
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	codes, err := app.twoFactor.Enable(r.Context(), user.ID, pending)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.recordEvent(r, user.ID, "user.2fa.enable", fmt.Sprintf("user:%d", user.ID))
+	app.session.Remove(r, "totpSecret")
+
+	// The recovery codes are only shown this once, so render them directly
+	// rather than redirecting.
+	app.render(w, r, "twofactor.page.tmpl", &templateData{
+		Form:              forms.New(nil),
+		TwoFactorEnabled:  true,
+		RecoveryCodes:     codes,
+		RecoveryCodesLeft: len(codes),
+	})
+}
+
+func (app *application) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	f := forms.New(r.PostForm)
+	f.Required("code")
+	if !f.Valid() {
+		app.renderTwoFactor(w, r, &templateData{Form: f})
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	err = app.checkSecondFactor(r.Context(), user.ID, f.Get("code"))
+	if err != nil {
+		if err == models.ErrInvalidCredentials {
+			f.Errors.Add("code", "The code is not valid")
+			app.renderTwoFactor(w, r, &templateData{Form: f})
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.twoFactor.Disable(r.Context(), user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.recordEvent(r, user.ID, "user.2fa.disable", fmt.Sprintf("user:%d", user.ID))
+	app.session.Put(r, "flash", "Two-factor authentication has been disabled")
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// How long a password reset link stays valid.
+const passwordResetTTL = time.Hour
+
+func (app *application) forgotPasswordForm(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, "forgot.page.tmpl", &templateData{
+		Form: forms.New(nil),
+	})
+}
+
+func (app *application) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	f := forms.New(r.PostForm)
+	f.Required("email")
+	f.MatchesPattern("email", forms.EmailRX)
+
+	if !f.Valid() {
+		app.render(w, r, "forgot.page.tmpl", &templateData{Form: f})
+		return
+	}
+
+	// We show the same message whether or not the email belongs to an
+	// account, so this page can't be used to find out who has signed up.
+	// For the same reason a failure to send the email is only logged: an
+	// error page would reveal that the account exists.
+	user, err := app.users.GetByEmail(r.Context(), f.Get("email"))
+	if err != nil && err != models.ErrNoRecord {
+		app.serverError(w, r, err)
+		return
+	}
+	if user != nil {
+		if err = app.sendPasswordReset(r.Context(), user); err != nil {
+			app.logError(r, fmt.Errorf("sending password reset: %w", err))
+		}
+	}
+
+	app.session.Put(r, "flash", "If there is an account with that email, we have sent it a link to reset the password")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// sendPasswordReset creates a password reset token for the user and emails
+// them a link to use it.
+func (app *application) sendPasswordReset(ctx context.Context, user *models.User) error {
+	token, err := app.resets.Insert(ctx, user.ID, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/user/password/reset?token=%s", app.baseURL, url.QueryEscape(token))
+	body := fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your Snippetbox account. "+
+		"If it was you, follow the link below within the next hour to choose a new password:\n\n%s\n\n"+
+		"If you didn't ask for this you can ignore this email.\n", user.Name, link)
+	return app.mailer.Send(user.Email, "Reset your Snippetbox password", body)
+}
+
+func (app *application) resetPasswordForm(w http.ResponseWriter, r *http.Request) {
+	f := forms.New(url.Values{})
+	f.Set("token", r.URL.Query().Get("token"))
+	app.render(w, r, "reset.page.tmpl", &templateData{Form: f})
+}
+
+func (app *application) resetPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	f := forms.New(r.PostForm)
+	f.Required("token", "password", "confirm_password")
+	f.MinLength("password", 10)
+	if f.Get("password") != f.Get("confirm_password") {
+		f.Errors.Add("confirm_password", "The passwords don't match")
+	}
+
+	if !f.Valid() {
+		app.render(w, r, "reset.page.tmpl", &templateData{Form: f})
+		return
+	}
+
+	id, err := app.resets.ResetPassword(r.Context(), f.Get("token"), f.Get("password"))
+	if err != nil {
+		if err == models.ErrNoRecord {
+			f.Errors.Add("generic", "This reset link is invalid or has expired. Please ask for a new one.")
+			app.render(w, r, "reset.page.tmpl", &templateData{Form: f})
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+	// Whoever knew the old password may still be logged in, so sign the
+	// account out everywhere.
+	if _, err = app.sessionStore.DeleteAll(r.Context(), id); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.recordEvent(r, id, "user.password.reset", fmt.Sprintf("user:%d", id))
+
+	app.session.Put(r, "flash", "Your password has been reset. Please log in.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) logout(w http.ResponseWriter, r *http.Request) {
+	// Revoke the server-side session, so that a copy of the cookie can't be
+	// used any more.
+	if s := app.currentSession(r); s != nil {
+		err := app.sessionStore.Delete(r.Context(), s.UserID, s.ID)
+		if err != nil && err != models.ErrNoRecord {
+			app.serverError(w, r, err)
+			return
+		}
+		app.recordEvent(r, s.UserID, "user.logout", fmt.Sprintf("user:%d", s.UserID))
+	}
+	app.endSession(r)
+	app.session.Remove(r, "pendingUserID")
 	app.session.Put(r, "flash", "You have been logout successfully")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// renderTokens renders the API tokens settings page for the authenticated
+// user, listing their existing tokens.
+func (app *application) renderTokens(w http.ResponseWriter, r *http.Request, td *templateData) {
+	tokens, err := app.tokens.List(r.Context(), app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	td.Tokens = tokens
+	app.render(w, r, "tokens.page.tmpl", td)
+}
+
+func (app *application) tokensPage(w http.ResponseWriter, r *http.Request) {
+	app.renderTokens(w, r, &templateData{
+		Form: forms.New(nil),
+	})
+}
+
+func (app *application) createToken(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	f := forms.New(r.PostForm)
+	f.Required("name")
+	f.MaxLength("name", 100)
+
+	if !f.Valid() {
+		app.renderTokens(w, r, &templateData{Form: f})
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	token, err := app.tokens.Insert(r.Context(), user.ID, f.Get("name"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.recordEvent(r, user.ID, "token.create", fmt.Sprintf("user:%d", user.ID))
+
+	// We render the page directly instead of redirecting, since this is the
+	// only time the plaintext token can be shown to the user.
+	app.renderTokens(w, r, &templateData{
+		Form:     forms.New(nil),
+		NewToken: token,
+	})
+}
+
+func (app *application) revokeToken(w http.ResponseWriter, r *http.Request) {
+	ID, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || ID <= 0 {
+		app.notFound(w)
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	err = app.tokens.Delete(r.Context(), user.ID, ID)
+	if err == models.ErrNoRecord {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.recordEvent(r, user.ID, "token.revoke", fmt.Sprintf("token:%d", ID))
+
+	app.session.Put(r, "flash", "The API token was revoked")
+	http.Redirect(w, r, "/user/tokens", http.StatusSeeOther)
+}
+
 func ping(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
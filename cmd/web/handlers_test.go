@@ -2,9 +2,17 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/mailer"
+	"wilbertopachecob/snippetbox/pkg/models/mock"
+	"wilbertopachecob/snippetbox/pkg/ratelimit"
+	"wilbertopachecob/snippetbox/pkg/totp"
 )
 
 //Testing handler
@@ -100,6 +108,68 @@ func TestPing(t *testing.T) {
 	}
 }
 
+func TestHome(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"First page", "/", http.StatusOK, []byte("An old silent pond")},
+		{"Page count", "/", http.StatusOK, []byte("Page 1 of 1")},
+		{"Explicit page", "/?page=1", http.StatusOK, []byte("An old silent pond")},
+		{"Past the last page", "/?page=2", http.StatusNotFound, nil},
+		{"Zero page", "/?page=0", http.StatusBadRequest, nil},
+		{"String page", "/?page=foo", http.StatusBadRequest, nil},
+		{"Huge page", "/?page=1000000000000000000", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := tls.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Empty query", "/search", http.StatusOK, []byte("Search snippets")},
+		{"Match", "/search?q=pond", http.StatusOK, []byte("An old silent <mark>pond</mark>")},
+		{"No match", "/search?q=frog", http.StatusOK, []byte("No snippets matched your search.")},
+		{"Query is escaped", "/search?q=%3Cscript%3E", http.StatusOK, []byte("&lt;script&gt;")},
+		{"Invalid page", "/search?q=pond&page=foo", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := tls.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
 func TestShowSnippet(t *testing.T) {
 	app := newTestApplication(t)
 	tls := newTestServer(t, app.routes())
@@ -112,12 +182,14 @@ func TestShowSnippet(t *testing.T) {
 		wantBody []byte
 	}{
 		{"Valid ID", "/snippet/1", http.StatusOK, []byte("An old silent pond...")},
+		{"Shows author", "/snippet/1", http.StatusOK, []byte("By: Admin")},
 		{"Non-existent ID", "/snippet/2", http.StatusNotFound, nil},
 		{"Negative ID", "/snippet/-1", http.StatusNotFound, nil},
 		{"Decimal ID", "/snippet/1.23", http.StatusNotFound, nil},
 		{"String ID", "/snippet/foo", http.StatusNotFound, nil},
 		{"Empty ID", "/snippet/", http.StatusNotFound, nil},
 		{"Trailing slash", "/snippet/1/", http.StatusNotFound, nil},
+		{"Query timeout", "/snippet/7", http.StatusServiceUnavailable, []byte("Service Unavailable")},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -179,3 +251,1011 @@ func TestSignupUser(t *testing.T) {
 		})
 	}
 }
+
+func TestSnippetVisibility(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Unlisted by id", "/snippet/5", http.StatusNotFound, nil},
+		{"Unlisted by slug", "/s/unlisted-slug", http.StatusOK, []byte("First autumn morning...")},
+		{"Unknown slug", "/s/wrong-slug", http.StatusNotFound, nil},
+		{"Private", "/snippet/6", http.StatusNotFound, nil},
+		{"API unlisted by id", "/api/v1/snippets/5", http.StatusNotFound, nil},
+		{"API private", "/api/v1/snippets/6", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := tls.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+
+	// Once logged in as its author, the private snippet is visible.
+	tls.login(t, "admin@gmail.com", "validPa$$word")
+	code, _, body := tls.get(t, "/snippet/6")
+	if code != http.StatusOK {
+		t.Errorf("want %d; got %d", http.StatusOK, code)
+	}
+	if !bytes.Contains(body, []byte("Only you can see this snippet")) {
+		t.Errorf("want body %s to say the snippet is private", body)
+	}
+}
+
+func TestShowSnippetEscapesContent(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	code, _, body := tls.get(t, "/snippet/4")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+
+	for _, field := range []string{"author", "title", "content"} {
+		if bytes.Contains(body, []byte("<script>alert('"+field+"')")) {
+			t.Errorf("want the %s to be escaped; got %s", field, body)
+		}
+	}
+	for _, want := range [][]byte{
+		[]byte("&lt;script&gt;alert(&#39;author&#39;)&lt;/script&gt;"),
+		[]byte("&lt;script&gt;alert(&#39;title&#39;)&lt;/script&gt;"),
+		[]byte("&lt;script&gt;"),
+	} {
+		if !bytes.Contains(body, want) {
+			t.Errorf("want body %s to contain %q", body, want)
+		}
+	}
+}
+
+func TestCreateSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, header, _ := tls.get(t, "/snippet/create")
+		if code != http.StatusSeeOther {
+			t.Errorf("want %d; got %d", http.StatusSeeOther, code)
+		}
+		if loc := header.Get("Location"); loc != "/user/login" {
+			t.Errorf("want %q; got %q", "/user/login", loc)
+		}
+	})
+
+	tls.login(t, "admin@gmail.com", "validPa$$word")
+
+	_, _, body := tls.get(t, "/snippet/create")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		title        string
+		content      string
+		language     string
+		visibility   string
+		expires      string
+		wantCode     int
+		wantLocation string
+		wantBody     []byte
+	}{
+		{"Valid submission", "Title", "Content", "go", "public", "7", http.StatusSeeOther, "/snippet/2", nil},
+		{"Unlisted", "Title", "Content", "go", "unlisted", "7", http.StatusSeeOther, "/snippet/2", nil},
+		{"Empty title", "", "Content", "go", "public", "7", http.StatusOK, "", []byte("This field can not be empty")},
+		{"Empty language", "Title", "Content", "", "public", "7", http.StatusOK, "", []byte("This field can not be empty")},
+		{"Invalid language", "Title", "Content", "cobol", "public", "7", http.StatusOK, "", []byte("This field is invalid")},
+		{"Invalid visibility", "Title", "Content", "go", "secret", "7", http.StatusOK, "", []byte("This field is invalid")},
+		{"Invalid expires", "Title", "Content", "go", "public", "2", http.StatusOK, "", []byte("This field is invalid")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("content", tt.content)
+			form.Add("language", tt.language)
+			form.Add("visibility", tt.visibility)
+			form.Add("expires", tt.expires)
+			form.Add("csrf_token", csrfToken)
+			code, header, body := tls.postForm(t, "/snippet/create", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, loc)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestEditSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	tls.login(t, "admin@gmail.com", "validPa$$word")
+
+	code, _, body := tls.get(t, "/snippet/1/edit")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+	if !bytes.Contains(body, []byte("An old silent pond...")) {
+		t.Errorf("want body %s to contain the snippet content", body)
+	}
+	if !bytes.Contains(body, []byte("value='keep' checked")) {
+		t.Errorf("want body %s to keep the current expiry by default", body)
+	}
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		title        string
+		expires      string
+		wantCode     int
+		wantLocation string
+		wantBody     []byte
+	}{
+		{"Valid submission", "/snippet/1/edit", "New title", "7", http.StatusSeeOther, "/snippet/1", nil},
+		{"Keep expiry", "/snippet/1/edit", "New title", "keep", http.StatusSeeOther, "/snippet/1", nil},
+		{"Invalid expiry", "/snippet/1/edit", "New title", "30", http.StatusOK, "", []byte("This field is invalid")},
+		{"Empty title", "/snippet/1/edit", "", "7", http.StatusOK, "", []byte("This field can not be empty")},
+		{"Not the owner", "/snippet/3/edit", "New title", "7", http.StatusForbidden, "", nil},
+		{"Non-existent ID", "/snippet/2/edit", "New title", "7", http.StatusNotFound, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("content", "Content")
+			form.Add("language", "plaintext")
+			form.Add("visibility", "public")
+			form.Add("expires", tt.expires)
+			form.Add("csrf_token", csrfToken)
+			code, header, body := tls.postForm(t, tt.urlPath, form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, loc)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestDeleteSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	tls.login(t, "admin@gmail.com", "validPa$$word")
+
+	_, _, body := tls.get(t, "/snippet/1")
+	if !bytes.Contains(body, []byte("/snippet/1/delete")) {
+		t.Errorf("want the owner to see a delete button")
+	}
+	csrfToken := extractCSRFToken(t, body)
+
+	_, _, body = tls.get(t, "/snippet/3")
+	if bytes.Contains(body, []byte("/snippet/3/delete")) {
+		t.Errorf("want other users not to see a delete button")
+	}
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{"Owner", "/snippet/1/delete", http.StatusSeeOther},
+		{"Not the owner", "/snippet/3/delete", http.StatusForbidden},
+		{"Non-existent ID", "/snippet/2/delete", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			code, _, _ := tls.postForm(t, tt.urlPath, form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestTokens(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	tls.login(t, "admin@gmail.com", "validPa$$word")
+
+	code, _, body := tls.get(t, "/user/tokens")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+	if !bytes.Contains(body, []byte("CI scripts")) {
+		t.Errorf("want body %s to list the existing token", body)
+	}
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		form     url.Values
+		wantCode int
+		wantBody []byte
+	}{
+		{"Create", "/user/tokens", url.Values{"name": {"Laptop"}}, http.StatusOK, []byte("new-plaintext-token")},
+		{"Create without name", "/user/tokens", url.Values{"name": {""}}, http.StatusOK, []byte("This field can not be empty")},
+		{"Revoke", "/user/tokens/1/delete", url.Values{}, http.StatusSeeOther, nil},
+		{"Revoke non-existent", "/user/tokens/2/delete", url.Values{}, http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.form.Add("csrf_token", csrfToken)
+			code, _, body := tls.postForm(t, tt.urlPath, tt.form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestForgotPassword(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	_, _, body := tls.get(t, "/user/password/forgot")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		email        string
+		wantCode     int
+		wantBody     []byte
+		wantMessages int
+	}{
+		{"Empty email", "", http.StatusOK, []byte("This field can not be empty"), 0},
+		{"Invalid email", "admin@", http.StatusOK, []byte("This field is invalid"), 0},
+		{"Unknown email", "nobody@example.com", http.StatusSeeOther, nil, 0},
+		{"Known email", "admin@gmail.com", http.StatusSeeOther, nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("csrf_token", csrfToken)
+			code, _, body := tls.postForm(t, "/user/password/forgot", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+			if n := len(app.mailer.(*mailer.MemoryMailer).Messages()); n != tt.wantMessages {
+				t.Errorf("want %d emails sent; got %d", tt.wantMessages, n)
+			}
+		})
+	}
+
+	msg := app.mailer.(*mailer.MemoryMailer).Messages()[0]
+	if msg.To != "admin@gmail.com" {
+		t.Errorf("want email to %q; got %q", "admin@gmail.com", msg.To)
+	}
+	wantLink := "https://snippetbox.test/user/password/reset?token=valid-reset-token"
+	if !strings.Contains(msg.Body, wantLink) {
+		t.Errorf("want email body %q to contain %q", msg.Body, wantLink)
+	}
+}
+
+type failingMailer struct{}
+
+func (failingMailer) Send(to, subject, body string) error {
+	return errors.New("mail server unavailable")
+}
+
+func TestForgotPasswordMailerFailure(t *testing.T) {
+	app := newTestApplication(t)
+	app.mailer = failingMailer{}
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	_, _, body := tls.get(t, "/user/password/forgot")
+	csrfToken := extractCSRFToken(t, body)
+
+	// A failure to send the email must look the same as an unknown address.
+	for _, email := range []string{"nobody@example.com", "admin@gmail.com"} {
+		form := url.Values{}
+		form.Add("email", email)
+		form.Add("csrf_token", csrfToken)
+		code, header, _ := tls.postForm(t, "/user/password/forgot", form)
+		if code != http.StatusSeeOther {
+			t.Errorf("%s: want %d; got %d", email, http.StatusSeeOther, code)
+		}
+		if loc := header.Get("Location"); loc != "/user/login" {
+			t.Errorf("%s: want location %q; got %q", email, "/user/login", loc)
+		}
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	_, _, body := tls.get(t, "/user/password/reset?token=valid-reset-token")
+	if !bytes.Contains(body, []byte("value='valid-reset-token'")) {
+		t.Errorf("want the token in a hidden field; got %s", body)
+	}
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		token    string
+		password string
+		confirm  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Valid token", "valid-reset-token", "newPa$$word", "newPa$$word", http.StatusSeeOther, nil},
+		{"Short password", "valid-reset-token", "pa$$", "pa$$", http.StatusOK, []byte("This field is too short")},
+		{"Mismatched passwords", "valid-reset-token", "newPa$$word", "otherPa$$word", http.StatusOK, []byte("The passwords don&#39;t match")},
+		{"Invalid token", "wrong-token", "newPa$$word", "newPa$$word", http.StatusOK, []byte("invalid or has expired")},
+		{"Missing token", "", "newPa$$word", "newPa$$word", http.StatusOK, []byte("This reset link is invalid")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("token", tt.token)
+			form.Add("password", tt.password)
+			form.Add("confirm_password", tt.confirm)
+			form.Add("csrf_token", csrfToken)
+			code, _, body := tls.postForm(t, "/user/password/reset", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAccount(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	code, header, _ := tls.get(t, "/account")
+	if code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+		t.Errorf("want a redirect to the login page; got %d %q", code, header.Get("Location"))
+	}
+
+	tls.login(t, "admin@gmail.com", "validPa$$word")
+
+	code, _, body := tls.get(t, "/account")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+	if !bytes.Contains(body, []byte("value='admin@gmail.com'")) {
+		t.Errorf("want the form to be filled with the user's email; got %s", body)
+	}
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		userName string
+		email    string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Valid submission", "Admin", "new@example.com", http.StatusSeeOther, nil},
+		{"Empty name", "", "new@example.com", http.StatusOK, []byte("This field can not be empty")},
+		{"Invalid email", "Admin", "new@", http.StatusOK, []byte("This field is invalid")},
+		{"Duplicate email", "Admin", "dupe@example.com", http.StatusOK, []byte("This email already exist on the DB")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("name", tt.userName)
+			form.Add("email", tt.email)
+			form.Add("csrf_token", csrfToken)
+			code, _, body := tls.postForm(t, "/account", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	tls.login(t, "admin@gmail.com", "validPa$$word")
+
+	_, _, body := tls.get(t, "/account/password")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		current  string
+		password string
+		confirm  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Valid submission", "validPa$$word", "newPa$$word", "newPa$$word", http.StatusSeeOther, nil},
+		{"Wrong current password", "wrongPa$$word", "newPa$$word", "newPa$$word", http.StatusOK, []byte("Your current password is not correct")},
+		{"Short password", "validPa$$word", "pa$$", "pa$$", http.StatusOK, []byte("This field is too short")},
+		{"Mismatched passwords", "validPa$$word", "newPa$$word", "otherPa$$word", http.StatusOK, []byte("The passwords don&#39;t match")},
+		{"Empty current password", "", "newPa$$word", "newPa$$word", http.StatusOK, []byte("This field can not be empty")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("current_password", tt.current)
+			form.Add("password", tt.password)
+			form.Add("confirm_password", tt.confirm)
+			form.Add("csrf_token", csrfToken)
+			code, _, body := tls.postForm(t, "/account/password", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestLoginUser(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	_, _, body := tls.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	// Every failure shows the same message, so that the form doesn't reveal
+	// which email addresses have an account.
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Valid", "admin@gmail.com", "validPa$$word", http.StatusSeeOther, nil},
+		{"Wrong password", "bob@example.com", "wrong", http.StatusOK, []byte(loginFailedMessage)},
+		{"Unknown email", "nobody@example.com", "validPa$$word", http.StatusOK, []byte(loginFailedMessage)},
+		{"Locked account", "locked@example.com", "validPa$$word", http.StatusOK, []byte(loginFailedMessage)},
+		{"Disabled account", "disabled@example.com", "validPa$$word", http.StatusOK, []byte("Your account has been disabled")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("password", tt.password)
+			form.Add("csrf_token", csrfToken)
+			code, _, body := tls.postForm(t, "/user/login", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	app := newTestApplication(t)
+	// Allow 5 attempts from the test client's IP address, and 2 for each
+	// account, with no refill during the test.
+	app.loginLimits = loginLimits{
+		ip:      ratelimit.New(time.Hour, 5, ratelimit.NewMemoryStore(time.Hour)),
+		account: ratelimit.New(time.Hour, 2, ratelimit.NewMemoryStore(time.Hour)),
+	}
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	_, _, body := tls.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		email    string
+		wantCode int
+	}{
+		{"First attempt", "bob@example.com", http.StatusOK},
+		{"Second attempt", "bob@example.com", http.StatusOK},
+		{"Account limit reached", "bob@example.com", http.StatusTooManyRequests},
+		{"Same account in another case", "BOB@example.com", http.StatusTooManyRequests},
+		{"Other account", "carol@example.com", http.StatusOK},
+		{"IP limit reached", "dave@example.com", http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		form := url.Values{}
+		form.Add("email", tt.email)
+		form.Add("password", "wrong")
+		form.Add("csrf_token", csrfToken)
+		code, header, _ := tls.postForm(t, "/user/login", form)
+		if code != tt.wantCode {
+			t.Fatalf("%s: want %d; got %d", tt.name, tt.wantCode, code)
+		}
+		if code == http.StatusTooManyRequests && header.Get("Retry-After") == "" {
+			t.Errorf("%s: want a Retry-After header", tt.name)
+		}
+	}
+
+	if got := app.metrics.logins.Value("limited"); got != 3 {
+		t.Errorf("want 3 limited logins; got %v", got)
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	tests := []struct {
+		name         string
+		code         string
+		wantCode     int
+		wantLocation string
+		wantBody     []byte
+	}{
+		{"Authenticator code", "123456", http.StatusSeeOther, "/snippet/create", nil},
+		{"Recovery code", "abcde-fghjk", http.StatusSeeOther, "/snippet/create", nil},
+		{"Wrong code", "654321", http.StatusOK, "", []byte("The code is not valid")},
+		{"Empty code", "", http.StatusOK, "", []byte("This field can not be empty")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			tls := newTestServer(t, app.routes())
+			defer tls.Close()
+
+			_, _, body := tls.get(t, "/user/login")
+			csrfToken := extractCSRFToken(t, body)
+			form := url.Values{}
+			form.Add("email", "twofactor@example.com")
+			form.Add("password", "validPa$$word")
+			form.Add("csrf_token", csrfToken)
+			code, header, _ := tls.postForm(t, "/user/login", form)
+			if code != http.StatusSeeOther || header.Get("Location") != "/user/login/2fa" {
+				t.Fatalf("want a redirect to the second step; got %d %q", code, header.Get("Location"))
+			}
+
+			// The password alone doesn't log the user in.
+			code, _, _ = tls.get(t, "/account")
+			if code != http.StatusSeeOther {
+				t.Errorf("want %d before the second step; got %d", http.StatusSeeOther, code)
+			}
+
+			form = url.Values{}
+			form.Add("code", tt.code)
+			form.Add("csrf_token", csrfToken)
+			code, header, body = tls.postForm(t, "/user/login/2fa", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, loc)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestTwoFactorLoginWithoutPassword(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	code, header, _ := tls.get(t, "/user/login/2fa")
+	if code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+		t.Errorf("want a redirect to the login page; got %d %q", code, header.Get("Location"))
+	}
+}
+
+func TestEnableTwoFactor(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	tls.login(t, "admin@gmail.com", "validPa$$word")
+	_, _, body := tls.get(t, "/account/2fa")
+	csrfToken := extractCSRFToken(t, body)
+
+	// The page shows a new secret, which stays the same until it is enabled.
+	matches := regexp.MustCompile(`<code>([A-Z2-7]{32})</code>`).FindSubmatch(body)
+	if matches == nil {
+		t.Fatalf("want a secret in the body %s", body)
+	}
+	secret := string(matches[1])
+	_, _, body = tls.get(t, "/account/2fa")
+	if !bytes.Contains(body, []byte(secret)) {
+		t.Errorf("want the same secret on every visit")
+	}
+	if !bytes.Contains(body, []byte("<a href='otpauth://totp/Snippetbox:admin@gmail.com?")) {
+		t.Errorf("want a setup link in the body %s", body)
+	}
+
+	validCode, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		wantBody []byte
+	}{
+		{"Empty code", "", []byte("This field can not be empty")},
+		{"Wrong code", "000000x", []byte("The code is not valid")},
+		{"Valid code", validCode, []byte("abcde-fghjk")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("code", tt.code)
+			form.Add("csrf_token", csrfToken)
+			code, _, body := tls.postForm(t, "/account/2fa/enable", form)
+			if code != http.StatusOK {
+				t.Errorf("want %d; got %d", http.StatusOK, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSessions(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	// Log in as the same user from two browsers. Both servers share the
+	// application, and so the session store.
+	laptop := newTestServer(t, routes)
+	defer laptop.Close()
+	laptop.login(t, "admin@gmail.com", "validPa$$word")
+	phone := newTestServer(t, routes)
+	defer phone.Close()
+	phone.login(t, "admin@gmail.com", "validPa$$word")
+
+	_, _, body := laptop.get(t, "/account/sessions")
+	csrfToken := extractCSRFToken(t, body)
+	if n := bytes.Count(body, []byte("/account/sessions/")); n != 3 {
+		t.Errorf("want 2 sessions and the log out everywhere form; got %d forms in %s", n, body)
+	}
+	if !bytes.Contains(body, []byte("(this device)")) {
+		t.Errorf("want the current session to be marked in %s", body)
+	}
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Unknown session", "/account/sessions/99/delete", http.StatusNotFound, ""},
+		{"Invalid ID", "/account/sessions/foo/delete", http.StatusNotFound, ""},
+		{"Other device", "/account/sessions/2/delete", http.StatusSeeOther, "/account/sessions"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			code, header, _ := laptop.postForm(t, tt.urlPath, form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, loc)
+			}
+		})
+	}
+
+	// The revoked session no longer logs the phone in, but the laptop is
+	// still logged in.
+	code, header, _ := phone.get(t, "/account")
+	if code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+		t.Errorf("want the revoked session to be logged out; got %d %q", code, header.Get("Location"))
+	}
+	code, _, _ = laptop.get(t, "/account")
+	if code != http.StatusOK {
+		t.Errorf("want %d; got %d", http.StatusOK, code)
+	}
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	laptop := newTestServer(t, routes)
+	defer laptop.Close()
+	laptop.login(t, "admin@gmail.com", "validPa$$word")
+	phone := newTestServer(t, routes)
+	defer phone.Close()
+	phone.login(t, "admin@gmail.com", "validPa$$word")
+
+	_, _, body := laptop.get(t, "/account/sessions")
+	form := url.Values{}
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	code, header, _ := laptop.postForm(t, "/account/sessions/delete-all", form)
+	if code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+		t.Fatalf("want a redirect to the login page; got %d %q", code, header.Get("Location"))
+	}
+
+	for name, tls := range map[string]*testServer{"laptop": laptop, "phone": phone} {
+		code, _, _ := tls.get(t, "/account")
+		if code != http.StatusSeeOther {
+			t.Errorf("%s: want %d; got %d", name, http.StatusSeeOther, code)
+		}
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name         string
+		email        string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Anonymous", "", "/admin", http.StatusSeeOther, "/user/login"},
+		{"Moderator on admin page", "moderator@example.com", "/admin", http.StatusForbidden, ""},
+		{"Moderator on audit log", "moderator@example.com", "/admin/audit", http.StatusForbidden, ""},
+		{"Admin", "admin@gmail.com", "/admin", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			tls := newTestServer(t, app.routes())
+			defer tls.Close()
+
+			if tt.email != "" {
+				tls.login(t, tt.email, "validPa$$word")
+			}
+			code, header, _ := tls.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, loc)
+			}
+		})
+	}
+}
+
+func TestAdminUsers(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	tls.login(t, "admin@gmail.com", "validPa$$word")
+
+	_, _, body := tls.get(t, "/admin")
+	for _, email := range []string{"admin@gmail.com", "twofactor@example.com", "moderator@example.com"} {
+		if !bytes.Contains(body, []byte(email)) {
+			t.Errorf("want body %s to contain %q", body, email)
+		}
+	}
+	_, _, body = tls.get(t, "/admin?q=Dave")
+	if !bytes.Contains(body, []byte("moderator@example.com")) || bytes.Contains(body, []byte("twofactor@example.com")) {
+		t.Errorf("want only the matching user in %s", body)
+	}
+	if code, _, _ := tls.get(t, "/admin?page=2"); code != http.StatusNotFound {
+		t.Errorf("want %d past the last page; got %d", http.StatusNotFound, code)
+	}
+	if code, _, _ := tls.get(t, "/admin?page=1000000000000000000"); code != http.StatusBadRequest {
+		t.Errorf("want %d for a huge page; got %d", http.StatusBadRequest, code)
+	}
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+		wantEvent    string
+	}{
+		{"Disable user", "/admin/users/2/disable", http.StatusSeeOther, "/admin", "admin.user.disable"},
+		{"Enable user", "/admin/users/2/enable", http.StatusSeeOther, "/admin", "admin.user.enable"},
+		{"Disable yourself", "/admin/users/1/disable", http.StatusSeeOther, "/admin", ""},
+		{"Unknown user", "/admin/users/99/disable", http.StatusNotFound, "", ""},
+		{"Invalid ID", "/admin/users/foo/disable", http.StatusNotFound, "", ""},
+	}
+
+	audit := app.audit.(*mock.AuditModel)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(audit.Events())
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			code, header, _ := tls.postForm(t, tt.urlPath, form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, loc)
+			}
+
+			events := audit.Events()[before:]
+			if tt.wantEvent == "" {
+				if len(events) != 0 {
+					t.Errorf("want no audit event; got %+v", events[0])
+				}
+				return
+			}
+			if len(events) != 1 || events[0].Event != tt.wantEvent || events[0].ActorID != 1 || events[0].Target != "user:2" {
+				t.Errorf("want a %s event by user 1 on user:2; got %d events", tt.wantEvent, len(events))
+			}
+		})
+	}
+}
+
+func TestAdminDeleteSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	tls.login(t, "moderator@example.com", "validPa$$word")
+	audit := app.audit.(*mock.AuditModel)
+	before := len(audit.Events())
+	_, _, body := tls.get(t, "/snippet/3")
+	if !bytes.Contains(body, []byte("/admin/snippets/3/delete")) {
+		t.Errorf("want a moderator delete button in %s", body)
+	}
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{"Another user's snippet", "/admin/snippets/3/delete", http.StatusSeeOther},
+		{"Unknown snippet", "/admin/snippets/99/delete", http.StatusNotFound},
+		{"Invalid ID", "/admin/snippets/foo/delete", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			code, _, _ := tls.postForm(t, tt.urlPath, form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+		})
+	}
+
+	events := audit.Events()[before:]
+	if len(events) != 1 || events[0].Event != "admin.snippet.delete" || events[0].ActorID != 3 || events[0].Target != "snippet:3" {
+		t.Errorf("want one admin.snippet.delete event; got %d events", len(events))
+	}
+}
+
+func TestAuditEvents(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	_, _, body := tls.get(t, "/user/signup")
+	csrfToken := extractCSRFToken(t, body)
+	form := url.Values{}
+	form.Add("name", "Admin")
+	form.Add("email", "admin@gmail.com")
+	form.Add("password", "validPa$$word")
+	form.Add("csrf_token", csrfToken)
+	tls.postForm(t, "/user/signup", form)
+
+	form = url.Values{}
+	form.Add("email", "bob@example.com")
+	form.Add("password", "wrong")
+	form.Add("csrf_token", csrfToken)
+	tls.postForm(t, "/user/login", form)
+
+	tls.login(t, "admin@gmail.com", "validPa$$word")
+
+	form = url.Values{}
+	form.Add("title", "An old silent pond")
+	form.Add("content", "An old silent pond...")
+	form.Add("language", "plaintext")
+	form.Add("visibility", "public")
+	form.Add("expires", "7")
+	form.Add("csrf_token", csrfToken)
+	tls.postForm(t, "/snippet/create", form)
+
+	form = url.Values{}
+	form.Add("csrf_token", csrfToken)
+	tls.postForm(t, "/user/logout", form)
+
+	want := []struct {
+		event   string
+		actorID int
+		target  string
+	}{
+		{"user.signup", 4, "user:4"},
+		{"user.login.failure", 0, "email:bob@example.com"},
+		{"user.login", 1, "user:1"},
+		{"snippet.create", 1, "snippet:2"},
+		{"user.logout", 1, "user:1"},
+	}
+	events := app.audit.(*mock.AuditModel).Events()
+	if len(events) != len(want) {
+		t.Fatalf("want %d events; got %d", len(want), len(events))
+	}
+	for i, e := range events {
+		if e.Event != want[i].event || e.ActorID != want[i].actorID || e.Target != want[i].target {
+			t.Errorf("event %d: want %+v; got %+v", i, want[i], e)
+		}
+		if e.IPAddress != "127.0.0.1" || e.UserAgent == "" {
+			t.Errorf("event %d: want the client's address and user agent; got %q %q", i, e.IPAddress, e.UserAgent)
+		}
+	}
+}
+
+func TestAdminAudit(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	tls.login(t, "admin@gmail.com", "validPa$$word")
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"All events", "/admin/audit", http.StatusOK, []byte("user.login")},
+		{"Date range", "/admin/audit?since=2021-04-01&until=2099-12-31", http.StatusOK, []byte("user.login")},
+		{"Before the login", "/admin/audit?until=2021-04-01", http.StatusOK, []byte("No events were recorded")},
+		{"Invalid date", "/admin/audit?since=yesterday", http.StatusOK, []byte("This field must be a date")},
+		{"Invalid page", "/admin/audit?page=0", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := tls.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -1,26 +1,120 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
-	"runtime/debug"
+	"strconv"
+	"time"
 	"wilbertopachecob/snippetbox/pkg/models"
 )
 
-func (app *application) serverError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.errorlog.Output(2, trace)
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+	status := serverErrorStatus(err)
+	http.Error(w, http.StatusText(status), status)
+}
+
+// logError logs an unexpected error along with the request it happened in.
+func (app *application) logError(r *http.Request, err error) {
+	app.logger.PrintError(err, map[string]string{
+		"request_id": requestID(r),
+		"method":     r.Method,
+		"uri":        r.URL.RequestURI(),
+	})
+}
+
+// serverErrorStatus returns the status code for an unexpected error. A query
+// that ran out of time means the database is overloaded or unreachable rather
+// than that something is broken, so we tell the client to try again later.
+func serverErrorStatus(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
 }
 
 func (app *application) clientError(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
 }
 
+// tooManyRequests sends a 429 Too Many Requests response to a client which
+// has been rate limited, telling it when to try again.
+func (app *application) tooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	app.metrics.logins.Inc("limited")
+	app.logger.PrintInfo("login rate limited", map[string]string{
+		"request_id":  requestID(r),
+		"remote_addr": r.RemoteAddr,
+	})
+	app.clientError(w, http.StatusTooManyRequests)
+}
+
 func (app *application) notFound(w http.ResponseWriter) {
 	http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 }
 
+// writeJSON encodes v as the JSON body of the response with the given status
+// code.
+func (app *application) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+// apiError is the body sent by the JSON API when a request fails. Fields
+// holds the validation errors for each input field, if any.
+type apiError struct {
+	Error  string              `json:"error"`
+	Fields map[string][]string `json:"fields,omitempty"`
+}
+
+// The apiServerError and apiClientError helpers are the JSON API equivalents
+// of serverError and clientError.
+func (app *application) apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+	app.apiClientError(w, serverErrorStatus(err))
+}
+
+func (app *application) apiClientError(w http.ResponseWriter, status int) {
+	app.writeJSON(w, status, apiError{Error: http.StatusText(status)})
+}
+
+// canView reports whether a user, who is nil for anonymous requests, may see
+// a snippet. Authors can always see their own snippets. Anybody else can see
+// public snippets, and unlisted ones when they were requested by their slug.
+func canView(s *models.Snippet, user *models.User, bySlug bool) bool {
+	if user != nil && user.ID == s.UserID {
+		return true
+	}
+	switch s.Visibility {
+	case models.VisibilityPublic:
+		return true
+	case models.VisibilityUnlisted:
+		return bySlug
+	default:
+		return false
+	}
+}
+
+// requestID returns the id the requestID middleware gave the request, or an
+// empty string if it hasn't been through it.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(contextKeyRequestID).(string)
+	return id
+}
+
 func (app *application) authenticatedUser(r *http.Request) *models.User {
 	user, ok := r.Context().Value(contextKeyUser).(*models.User)
 	if !ok {
@@ -28,3 +122,86 @@ func (app *application) authenticatedUser(r *http.Request) *models.User {
 	}
 	return user
 }
+
+// currentSession returns the server-side session of a user logged in through
+// the login form, or nil for anonymous requests and API token requests.
+func (app *application) currentSession(r *http.Request) *models.Session {
+	s, _ := r.Context().Value(contextKeySession).(*models.Session)
+	return s
+}
+
+// recordEvent writes an entry to the audit log for an event performed by the
+// user actorID, with the address and user agent of the request. The action
+// has already happened by the time it is recorded, so a failure is logged
+// rather than shown to the user.
+func (app *application) recordEvent(r *http.Request, actorID int, event, target string) {
+	err := app.audit.Insert(r.Context(), actorID, clientIP(r), r.UserAgent(), event, target)
+	if err != nil {
+		app.logError(r, fmt.Errorf("recording %s event: %w", event, err))
+	}
+}
+
+// clientIP returns the IP address the request came from, without the port.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// The number of snippets shown on each page of a listing.
+const snippetsPageSize = 10
+
+// pagination holds what templates need to render next/previous links for a
+// paginated listing.
+type pagination struct {
+	Page     int
+	PageSize int
+	Total    int
+}
+
+// LastPage returns the number of the last page. An empty listing still has
+// one (empty) page.
+func (p *pagination) LastPage() int {
+	if p.Total == 0 {
+		return 1
+	}
+	return (p.Total + p.PageSize - 1) / p.PageSize
+}
+
+func (p *pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+func (p *pagination) HasNext() bool {
+	return p.Page < p.LastPage()
+}
+
+func (p *pagination) PrevPage() int {
+	return p.Page - 1
+}
+
+func (p *pagination) NextPage() int {
+	return p.Page + 1
+}
+
+// maxPage is the highest page number pageParam accepts. It keeps the OFFSET
+// of the listing queries well away from overflowing, and no listing gets
+// anywhere near that long.
+const maxPage = 10000
+
+// pageParam reads the page number from the "page" query string parameter. A
+// missing parameter means the first page; anything other than an integer
+// from 1 to maxPage is an error.
+func pageParam(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("page")
+	if v == "" {
+		return 1, nil
+	}
+	page, err := strconv.Atoi(v)
+	if err != nil || page < 1 || page > maxPage {
+		return 0, fmt.Errorf("invalid page %q", v)
+	}
+	return page, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"wilbertopachecob/snippetbox/pkg/models"
+)
+
+func TestPagination(t *testing.T) {
+	tests := []struct {
+		name     string
+		p        pagination
+		wantLast int
+		wantPrev bool
+		wantNext bool
+	}{
+		{"Empty", pagination{Page: 1, PageSize: 10, Total: 0}, 1, false, false},
+		{"Single page", pagination{Page: 1, PageSize: 10, Total: 10}, 1, false, false},
+		{"First of many", pagination{Page: 1, PageSize: 10, Total: 11}, 2, false, true},
+		{"Middle", pagination{Page: 2, PageSize: 10, Total: 25}, 3, true, true},
+		{"Last", pagination{Page: 3, PageSize: 10, Total: 25}, 3, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.LastPage(); got != tt.wantLast {
+				t.Errorf("LastPage: want %d; got %d", tt.wantLast, got)
+			}
+			if got := tt.p.HasPrev(); got != tt.wantPrev {
+				t.Errorf("HasPrev: want %t; got %t", tt.wantPrev, got)
+			}
+			if got := tt.p.HasNext(); got != tt.wantNext {
+				t.Errorf("HasNext: want %t; got %t", tt.wantNext, got)
+			}
+		})
+	}
+}
+
+func TestCanView(t *testing.T) {
+	author := &models.User{ID: 1}
+	other := &models.User{ID: 2}
+
+	tests := []struct {
+		name       string
+		visibility string
+		user       *models.User
+		bySlug     bool
+		want       bool
+	}{
+		{"Public anonymous", models.VisibilityPublic, nil, false, true},
+		{"Unlisted anonymous by id", models.VisibilityUnlisted, nil, false, false},
+		{"Unlisted anonymous by slug", models.VisibilityUnlisted, nil, true, true},
+		{"Unlisted other user by id", models.VisibilityUnlisted, other, false, false},
+		{"Unlisted author by id", models.VisibilityUnlisted, author, false, true},
+		{"Private anonymous by slug", models.VisibilityPrivate, nil, true, false},
+		{"Private other user", models.VisibilityPrivate, other, false, false},
+		{"Private author", models.VisibilityPrivate, author, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &models.Snippet{UserID: author.ID, Visibility: tt.visibility}
+			if got := canView(s, tt.user, tt.bySlug); got != tt.want {
+				t.Errorf("want %t; got %t", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// purgeExpired permanently deletes the snippets and login sessions that have
+// expired. It isn't tied to a request, so only the models' own timeouts apply.
+func (app *application) purgeExpired() {
+	n, err := app.snippets.DeleteExpired(context.Background())
+	if err != nil {
+		app.logger.PrintError(fmt.Errorf("purging expired snippets: %w", err), nil)
+	} else if n > 0 {
+		app.logger.PrintInfo("purged expired snippets", map[string]string{"count": strconv.Itoa(n)})
+	}
+
+	n, err = app.sessionStore.DeleteExpired(context.Background())
+	if err != nil {
+		app.logger.PrintError(fmt.Errorf("purging expired sessions: %w", err), nil)
+	} else if n > 0 {
+		app.logger.PrintInfo("purged expired sessions", map[string]string{"count": strconv.Itoa(n)})
+	}
+}
+
+// startJanitor starts a background goroutine which purges expired snippets
+// and sessions every interval. Expired rows are already hidden by the
+// queries, this just stops them from piling up in the database. It returns a
+// function that stops the janitor and waits for it to finish the purge it's
+// running, if any. An interval of zero or less disables the janitor.
+func (app *application) startJanitor(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	quit := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				app.purgeExpired()
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(quit)
+			wg.Wait()
+		})
+	}
+}
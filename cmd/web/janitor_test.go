@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/jsonlog"
+)
+
+func TestJanitor(t *testing.T) {
+	app := newTestApplication(t)
+	var buf bytes.Buffer
+	app.logger = jsonlog.New(&buf, jsonlog.LevelInfo)
+
+	stop := app.startJanitor(10 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+
+	// Once stopped, nothing else should be written to the log.
+	n := buf.Len()
+	time.Sleep(30 * time.Millisecond)
+	if buf.Len() != n {
+		t.Errorf("janitor kept running after being stopped")
+	}
+
+	if !bytes.Contains(buf.Bytes(), []byte(`"message":"purged expired snippets","properties":{"count":"2"}`)) {
+		t.Errorf("want the purge to be logged; got %q", buf.String())
+	}
+
+	// Calling stop twice must not panic.
+	stop()
+}
+
+func TestJanitorDisabled(t *testing.T) {
+	app := newTestApplication(t)
+	var buf bytes.Buffer
+	app.logger = jsonlog.New(&buf, jsonlog.LevelInfo)
+
+	stop := app.startJanitor(0)
+	time.Sleep(20 * time.Millisecond)
+	stop()
+
+	if buf.Len() != 0 {
+		t.Errorf("want nothing logged; got %q", buf.String())
+	}
+}
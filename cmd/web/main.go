@@ -1,62 +1,111 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
 	"flag"
-	"fmt"
+	"html/template"
 	"log"
 	"net/http"
 	"os"
-	"text/template"
 	"time"
 
+	"wilbertopachecob/snippetbox/pkg/config"
+	"wilbertopachecob/snippetbox/pkg/jsonlog"
+	"wilbertopachecob/snippetbox/pkg/mailer"
 	"wilbertopachecob/snippetbox/pkg/models"
 	"wilbertopachecob/snippetbox/pkg/models/mysql"
+	"wilbertopachecob/snippetbox/pkg/models/sqlite"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/golangcollege/sessions"
-	"github.com/joho/godotenv"
 )
 
 type contextKey string
 
 var contextKeyUser = contextKey("user")
+var contextKeyRequestID = contextKey("requestID")
+var contextKeyRoute = contextKey("route")
+var contextKeySession = contextKey("session")
 
 type application struct {
-	infolog  *log.Logger
-	errorlog *log.Logger
+	logger   *jsonlog.Logger
 	snippets interface {
-		Insert(string, string, string) (int, error)
-		Get(int) (*models.Snippet, error)
-		Latest() ([]*models.Snippet, error)
+		Insert(context.Context, int, string, string, string, string, string) (int, error)
+		Update(context.Context, int, string, string, string, string, string) error
+		Delete(context.Context, int) error
+		DeleteExpired(context.Context) (int, error)
+		Get(context.Context, int) (*models.Snippet, error)
+		GetBySlug(context.Context, string) (*models.Snippet, error)
+		List(context.Context, int, int) ([]*models.Snippet, int, error)
+		Search(context.Context, string, int, int) ([]*models.Snippet, int, error)
 	}
 	users interface {
-		Insert(string, string, string) error
-		Authenticate(string, string) (int, error)
-		Get(int) (*models.User, error)
+		Insert(context.Context, string, string, string) (int, error)
+		Authenticate(context.Context, string, string) (int, error)
+		Get(context.Context, int) (*models.User, error)
+		GetByEmail(context.Context, string) (*models.User, error)
+		UpdatePassword(context.Context, int, string) error
+		UpdateProfile(context.Context, int, string, string) error
+		ChangePassword(context.Context, int, string, string) error
+		List(context.Context, string, int, int) ([]*models.User, int, error)
+		SetDisabled(context.Context, int, bool) error
+	}
+	audit interface {
+		Insert(context.Context, int, string, string, string, string) error
+		List(context.Context, time.Time, time.Time, int, int) ([]*models.AuditEvent, int, error)
+	}
+	// sessionStore keeps a record of every login on the server. The session
+	// cookie names one of them, so that it can be revoked.
+	sessionStore interface {
+		Insert(context.Context, int, string, string, time.Duration) (string, error)
+		Get(context.Context, string) (*models.Session, error)
+		Touch(context.Context, int) error
+		List(context.Context, int) ([]*models.Session, error)
+		Delete(context.Context, int, int) error
+		DeleteAll(context.Context, int) (int, error)
+		DeleteExpired(context.Context) (int, error)
+	}
+	twoFactor interface {
+		Secret(context.Context, int) (string, error)
+		Enable(context.Context, int, string) ([]string, error)
+		Disable(context.Context, int) error
+		Verify(context.Context, int, string) error
+		UseRecoveryCode(context.Context, int, string) error
+		RecoveryCodesLeft(context.Context, int) (int, error)
+	}
+	resets interface {
+		Insert(context.Context, int, time.Duration) (string, error)
+		ResetPassword(context.Context, string, string) (int, error)
+	}
+	tokens interface {
+		Insert(context.Context, int, string) (string, error)
+		List(context.Context, int) ([]*models.Token, error)
+		Delete(context.Context, int, int) error
+		Authenticate(context.Context, string) (int, error)
 	}
 	session       *sessions.Session
 	templateCache map[string]*template.Template
-}
-
-func getEnvVar(key string) string {
-	// load .env file
-	err := godotenv.Load(".env")
-
-	if err != nil {
-		log.Fatalf("Error loading .env file")
-	}
-
-	return os.Getenv(key)
+	mailer        mailer.Mailer
+	metrics       *appMetrics
+	// loginLimits rate limits the login attempts from each IP address and
+	// for each account.
+	loginLimits loginLimits
+	// metricsAddr is the address of the separate metrics server. When it is
+	// empty the metrics are served publicly on /metrics by the application
+	// itself.
+	metricsAddr string
+	// baseURL is the scheme and host the application is served from. It is
+	// used to build absolute links, such as those sent in emails.
+	baseURL string
 }
 
 func main() {
-	addr := flag.String("addr", ":4000", "HTTP network address")
+	config.RegisterFlags(flag.CommandLine)
 	// Importantly, we use the flag.Parse() function to parse the command-line
-	// This reads in the command-line flag value and assigns it to the addr
-	// variable. You need to call this *before* you use the addr variable
-	// otherwise it will always contain the default value of ":4000". If any er
+	// flags before loading the configuration, so that flags can override the
+	// values from the config file and the environment. If any error is
 	// encountered during parsing the application will be terminated.
 	flag.Parse()
 
@@ -68,37 +117,95 @@ func main() {
 	// defer f.Close()
 
 	// infoLog := log.New(f, "INFO\t", log.Ldate|log.Ltime)
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
-	dns := fmt.Sprintf("%s:%s@/%s?parseTime=true", getEnvVar("DB_USERNAME"), getEnvVar("DB_PASSWORD"), getEnvVar("DB_DATABASE"))
-	db, err := openDB(dns)
+	// Problems with the configuration are logged at the default level, since
+	// the configured one isn't known until it has been loaded.
+	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+
+	cfg, err := config.Load(flag.CommandLine)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	err = cfg.ValidateServer()
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	level, _ := jsonlog.ParseLevel(cfg.LogLevel)
+	logger = jsonlog.New(os.Stdout, level)
+
+	db, err := openDB(cfg.DB.DriverName(), cfg.DB.DSN())
 	if err != nil {
-		errorLog.Fatal(err)
+		logger.PrintFatal(err, nil)
 	}
-	defer db.Close()
 
 	templateCache, err := newTemplateCache("./ui/html/")
 	if err != nil {
-		errorLog.Fatal(err)
+		logger.PrintFatal(err, nil)
 	}
 
 	// Use the sessions.New() function to initialize a new session manager,
-	// passing in the secret key as the parameter. Then we configure it so
-	// sessions always expires after 1 hour.
-	secret := getEnvVar("COOKIE_SECRET")
-	session := sessions.New([]byte(secret))
-	session.Lifetime = 1 * time.Hour
+	// passing in the secret key as the parameter. Then we configure how long
+	// sessions last.
+	session := sessions.New([]byte(cfg.CookieSecret))
+	session.Lifetime = cfg.SessionLifetime
 	session.Secure = true
 	session.SameSite = http.SameSiteStrictMode
 
+	// Send emails through SMTP when a server is configured. Otherwise, write
+	// them to files so they can be read during local development.
+	var m mailer.Mailer = &mailer.FileMailer{Dir: cfg.MailDir, From: cfg.SMTP.From}
+	if cfg.SMTP.Host != "" {
+		m = &mailer.SMTPMailer{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.SMTP.From,
+		}
+	}
+
 	app := &application{
-		infolog:       infoLog,
-		errorlog:      errorLog,
-		snippets:      &mysql.SnippetModel{DB: db},
-		users:         &mysql.UserModel{DB: db},
+		logger:        logger,
 		templateCache: templateCache,
 		session:       session,
+		mailer:        m,
+		metrics:       newAppMetrics(),
+		metricsAddr:   cfg.MetricsAddr,
+		loginLimits:   newLoginLimits(),
+		baseURL:       cfg.BaseURL,
+	}
+	app.metrics.registerDBStats(db)
+
+	// Use the models matching the database driver. Both packages implement
+	// the same methods, so the rest of the application doesn't need to know
+	// which one is in use.
+	switch cfg.DB.Driver {
+	case config.DriverSQLite:
+		app.snippets = &sqlite.SnippetModel{DB: db, Timeout: cfg.QueryTimeout}
+		app.users = &sqlite.UserModel{
+			DB:              db,
+			Timeout:         cfg.QueryTimeout,
+			MaxFailedLogins: cfg.LoginMaxFailures,
+			LockoutDuration: cfg.LoginLockout,
+		}
+		app.audit = &sqlite.AuditModel{DB: db, Timeout: cfg.QueryTimeout}
+		app.sessionStore = &sqlite.SessionModel{DB: db, Timeout: cfg.QueryTimeout}
+		app.twoFactor = &sqlite.TwoFactorModel{DB: db, Timeout: cfg.QueryTimeout}
+		app.tokens = &sqlite.TokenModel{DB: db, Timeout: cfg.QueryTimeout}
+		app.resets = &sqlite.ResetTokenModel{DB: db, Timeout: cfg.QueryTimeout}
+	default:
+		app.snippets = &mysql.SnippetModel{DB: db, Timeout: cfg.QueryTimeout}
+		app.users = &mysql.UserModel{
+			DB:              db,
+			Timeout:         cfg.QueryTimeout,
+			MaxFailedLogins: cfg.LoginMaxFailures,
+			LockoutDuration: cfg.LoginLockout,
+		}
+		app.audit = &mysql.AuditModel{DB: db, Timeout: cfg.QueryTimeout}
+		app.sessionStore = &mysql.SessionModel{DB: db, Timeout: cfg.QueryTimeout}
+		app.twoFactor = &mysql.TwoFactorModel{DB: db, Timeout: cfg.QueryTimeout}
+		app.tokens = &mysql.TokenModel{DB: db, Timeout: cfg.QueryTimeout}
+		app.resets = &mysql.ResetTokenModel{DB: db, Timeout: cfg.QueryTimeout}
 	}
 
 	// Initialize a tls.Config struct to hold the non-default TLS settings we w
@@ -110,27 +217,41 @@ func main() {
 
 	// Initialize a new http.Server struct. We set the Addr and Handler fields
 	// that the server uses the same network address and routes as before, and
-	// the ErrorLog field so that the server now uses the custom errorLog logge
-	// the event of any problems.
+	// the ErrorLog field so that the server writes its own errors as ERROR
+	// entries of our structured logger.
 	svr := &http.Server{
-		Addr:      *addr,
+		Addr:      cfg.Addr,
 		Handler:   app.routes(),
 		TLSConfig: tlsConfig,
-		ErrorLog:  errorLog,
+		ErrorLog:  log.New(logger, "", 0),
 		// Add Idle, Read and Write timeouts to the server.
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  cfg.IdleTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+	}
+
+	stopJanitor := app.startJanitor(cfg.PurgeInterval)
+	stopMetrics := func() {}
+	if cfg.MetricsAddr != "" {
+		stopMetrics = app.startMetricsServer(cfg.MetricsAddr)
 	}
 
-	//log.Printf("Starting server on port %s", getEnvVar("PORT"))
-	infoLog.Printf("Starting server on port %s", *addr)
-	err = svr.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
-	errorLog.Fatal(err)
+	logger.PrintInfo("starting server", map[string]string{"addr": cfg.Addr})
+	err = app.serve(svr, cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.ShutdownTimeout)
+
+	// Whether the server stopped because of a signal or an error, stop the
+	// background workers before closing the database they use.
+	stopJanitor()
+	stopMetrics()
+	db.Close()
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	logger.PrintInfo("server stopped", nil)
 }
 
-func openDB(dns string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dns)
+func openDB(driver, dns string) (*sql.DB, error) {
+	db, err := sql.Open(driver, dns)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/metrics"
+
+	"github.com/bmizerany/pat"
+)
+
+// appMetrics holds the metrics the application records and exposes on
+// /metrics.
+type appMetrics struct {
+	registry *metrics.Registry
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+	logins   *metrics.CounterVec
+	sessions *metrics.CounterVec
+}
+
+func newAppMetrics() *appMetrics {
+	reg := metrics.NewRegistry()
+	return &appMetrics{
+		registry: reg,
+		requests: reg.NewCounterVec("snippetbox_http_requests_total",
+			"Number of HTTP requests handled, by route pattern and status code.",
+			"method", "route", "status"),
+		duration: reg.NewHistogramVec("snippetbox_http_request_duration_seconds",
+			"Time taken to handle HTTP requests, by route pattern.",
+			metrics.DefBuckets, "method", "route"),
+		logins: reg.NewCounterVec("snippetbox_logins_total",
+			"Number of login attempts, by result (success, failure or limited).",
+			"result"),
+		sessions: reg.NewCounterVec("snippetbox_sessions_total",
+			"Number of user sessions started by a login or ended by a logout, by event (started or ended).",
+			"event"),
+	}
+}
+
+// registerDBStats exposes the connection pool statistics of db. They are read
+// from db.Stats() each time the metrics are scraped.
+func (m *appMetrics) registerDBStats(db *sql.DB) {
+	m.registry.NewGaugeFunc("snippetbox_db_max_open_connections",
+		"Maximum number of open connections to the database.",
+		func() float64 { return float64(db.Stats().MaxOpenConnections) })
+	m.registry.NewGaugeFunc("snippetbox_db_open_connections",
+		"Number of established connections to the database, in use or idle.",
+		func() float64 { return float64(db.Stats().OpenConnections) })
+	m.registry.NewGaugeFunc("snippetbox_db_in_use_connections",
+		"Number of connections to the database currently in use.",
+		func() float64 { return float64(db.Stats().InUse) })
+	m.registry.NewGaugeFunc("snippetbox_db_idle_connections",
+		"Number of idle connections to the database.",
+		func() float64 { return float64(db.Stats().Idle) })
+	m.registry.NewCounterFunc("snippetbox_db_wait_count_total",
+		"Number of times a query waited for a free connection.",
+		func() float64 { return float64(db.Stats().WaitCount) })
+	m.registry.NewCounterFunc("snippetbox_db_wait_duration_seconds_total",
+		"Total time spent waiting for a free connection.",
+		func() float64 { return db.Stats().WaitDuration.Seconds() })
+	m.registry.NewCounterFunc("snippetbox_db_max_idle_closed_total",
+		"Number of connections closed because of the idle connection limit.",
+		func() float64 { return float64(db.Stats().MaxIdleClosed) })
+	m.registry.NewCounterFunc("snippetbox_db_max_lifetime_closed_total",
+		"Number of connections closed because they reached their maximum lifetime.",
+		func() float64 { return float64(db.Stats().MaxLifetimeClosed) })
+}
+
+// routeMux wraps a pat router so that every handler records the pattern it
+// was registered with. The metrics are labelled with the pattern rather than
+// the request path, which would give every snippet id its own series.
+type routeMux struct {
+	*pat.PatternServeMux
+}
+
+func (m routeMux) Get(pattern string, h http.Handler) {
+	m.PatternServeMux.Get(pattern, withRoute(pattern, h))
+}
+
+func (m routeMux) Post(pattern string, h http.Handler) {
+	m.PatternServeMux.Post(pattern, withRoute(pattern, h))
+}
+
+// routeLabel is stored in the request context by the recordMetrics middleware
+// and filled in by the handler of the matching route.
+type routeLabel struct {
+	pattern string
+}
+
+func withRoute(pattern string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if label, ok := r.Context().Value(contextKeyRoute).(*routeLabel); ok {
+			label.pattern = pattern
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// methodLabel returns the method label for a request. Clients can send any
+// method they like, so everything but the standard methods is recorded as
+// "other" to stop them from creating new series at will.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "other"
+	}
+}
+
+// recordMetrics counts every request and the time it took, by method, route
+// pattern and status code. Requests which didn't match any route are all
+// recorded as "unmatched".
+func (app *application) recordMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		label := &routeLabel{pattern: "unmatched"}
+		sr := &statusRecorder{ResponseWriter: w}
+		ctx := context.WithValue(r.Context(), contextKeyRoute, label)
+		next.ServeHTTP(sr, r.WithContext(ctx))
+
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		method := methodLabel(r.Method)
+		app.metrics.requests.Inc(method, label.pattern, strconv.Itoa(sr.status))
+		app.metrics.duration.Observe(time.Since(start).Seconds(), method, label.pattern)
+	})
+}
+
+// startMetricsServer serves the metrics over plain HTTP on addr, separately
+// from the application, so that they can be kept off the public network. It
+// returns a function which stops the server.
+func (app *application) startMetricsServer(addr string) (stop func()) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", app.metrics.registry.Handler())
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		app.logger.PrintInfo("starting metrics server", map[string]string{"addr": addr})
+		err := srv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			app.logger.PrintError(err, map[string]string{"addr": addr})
+		}
+	}()
+
+	return func() { srv.Close() }
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	app := newTestApplication(t)
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	tls.get(t, "/snippet/1")
+	tls.get(t, "/snippet/1")
+	tls.get(t, "/no/such/page")
+
+	// A made-up method mustn't get its own series.
+	req, err := http.NewRequest("BREW", tls.URL+"/snippet/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := tls.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	// A failed login followed by a successful one.
+	_, _, body := tls.get(t, "/user/login")
+	form := url.Values{}
+	form.Add("email", "nobody@example.com")
+	form.Add("password", "wrong")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	tls.postForm(t, "/user/login", form)
+	tls.login(t, "admin@gmail.com", "validPa$$word")
+
+	code, header, body := tls.get(t, "/metrics")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+	if ct := header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("want the Prometheus text format; got %q", ct)
+	}
+
+	want := []string{
+		`snippetbox_http_requests_total{method="GET",route="/snippet/:id",status="200"} 2`,
+		`snippetbox_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`snippetbox_http_requests_total{method="other",route="unmatched",status="405"} 1`,
+		`snippetbox_http_request_duration_seconds_count{method="GET",route="/snippet/:id"} 2`,
+		`snippetbox_logins_total{result="failure"} 1`,
+		`snippetbox_logins_total{result="success"} 1`,
+		`snippetbox_sessions_total{event="started"} 1`,
+	}
+	for _, w := range want {
+		if !bytes.Contains(body, []byte(w+"\n")) {
+			t.Errorf("want body to contain %q", w)
+		}
+	}
+}
+
+func TestMetricsSeparateAddr(t *testing.T) {
+	app := newTestApplication(t)
+	app.metricsAddr = "localhost:9100"
+	tls := newTestServer(t, app.routes())
+	defer tls.Close()
+
+	code, _, _ := tls.get(t, "/metrics")
+	if code != http.StatusNotFound {
+		t.Errorf("want %d; got %d", http.StatusNotFound, code)
+	}
+}
@@ -2,9 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 	"wilbertopachecob/snippetbox/pkg/models"
+	"wilbertopachecob/snippetbox/pkg/ratelimit"
 
 	"github.com/justinas/nosurf"
 )
@@ -17,10 +24,84 @@ func secureHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// validRequestID matches the request ids we accept from clients or proxies
+// in the X-Request-ID header. Anything else is replaced, so that arbitrary
+// text can't end up in our logs and responses.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestID gives every request an id, which is stored in the request
+// context and returned in the X-Request-ID response header so that a response
+// can be matched to its log entries. An id set by a proxy in front of us is
+// kept.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID.MatchString(id) {
+			b := make([]byte, 8)
+			if _, err := rand.Read(b); err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			id = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), contextKeyRequestID, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// statusRecorder wraps an http.ResponseWriter to remember the status code and
+// the number of bytes written in the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += n
+	return n, err
+}
+
+// Unwrap returns the original http.ResponseWriter, for http.ResponseController.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// logRequest logs every request once the handler has completed, along with
+// its status code, the size of the response body and how long it took.
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.infolog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL)
-		next.ServeHTTP(w, r)
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(sr, r)
+
+		// A handler that writes nothing sends an empty 200 response.
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		app.logger.PrintInfo("request completed", map[string]string{
+			"request_id":  requestID(r),
+			"remote_addr": r.RemoteAddr,
+			"proto":       r.Proto,
+			"method":      r.Method,
+			"uri":         r.URL.RequestURI(),
+			"status":      strconv.Itoa(sr.status),
+			"bytes":       strconv.Itoa(sr.bytes),
+			"duration":    time.Since(start).String(),
+		})
 	})
 }
 
@@ -35,6 +116,72 @@ func (app *application) requiredAuthenticated(next http.Handler) http.Handler {
 	})
 }
 
+// requireRole returns middleware which only lets through authenticated users
+// with the given role, or a more privileged one. Anonymous users are sent to
+// the login page, as with requiredAuthenticated, and everybody else gets a
+// 403 Forbidden.
+func (app *application) requireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return app.requiredAuthenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.authenticatedUser(r).HasRole(role) {
+				app.clientError(w, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
+
+// loginLimits holds the rate limiters of the login form.
+type loginLimits struct {
+	ip      *ratelimit.Limiter
+	account *ratelimit.Limiter
+}
+
+// newLoginLimits returns the limiters used in production. An IP address can
+// make 20 attempts at once and then one every 3 seconds, which leaves room
+// for several users behind the same proxy. Each account can be tried 5 times
+// at once and then once a minute, which together with the lockout in the
+// users model slows down guessing the password of a single account.
+func newLoginLimits() loginLimits {
+	return loginLimits{
+		ip:      ratelimit.New(3*time.Second, 20, ratelimit.NewMemoryStore(time.Hour)),
+		account: ratelimit.New(time.Minute, 5, ratelimit.NewMemoryStore(time.Hour)),
+	}
+}
+
+// limitLogins refuses login attempts with a 429 Too Many Requests response
+// once either the client's IP address or the account being logged in to has
+// used up its attempts.
+func (app *application) limitLogins(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, retryAfter := app.loginLimits.ip.Allow(clientIP(r)); !ok {
+			app.tooManyRequests(w, r, retryAfter)
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		// The first step of the login names the account with its email
+		// address. The second step, for accounts with two-factor
+		// authentication, finds it in the session.
+		account := strings.ToLower(strings.TrimSpace(r.PostForm.Get("email")))
+		if id := app.session.GetInt(r, "pendingUserID"); account == "" && id != 0 {
+			account = "user:" + strconv.Itoa(id)
+		}
+		if account != "" {
+			if ok, retryAfter := app.loginLimits.account.Allow(account); !ok {
+				app.tooManyRequests(w, r, retryAfter)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Create a deferred function (which will always be run in the event
@@ -44,7 +191,7 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 			// panic or not. If there has...
 			if err := recover(); err != nil {
 				w.Header().Set("Connection", "close")
-				app.serverError(w, fmt.Errorf("%s", err))
+				app.serverError(w, r, fmt.Errorf("%s", err))
 			}
 		}()
 
@@ -68,22 +215,81 @@ func noSurf(next http.Handler) http.Handler {
 
 func (app application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Non-browser clients authenticate with a personal API token sent in
+		// an "Authorization: Bearer <token>" header. If the header is present
+		// we use it instead of the session. An unknown token is treated the
+		// same as an anonymous request.
+		if token, ok := bearerToken(r); ok {
+			id, err := app.tokens.Authenticate(r.Context(), token)
+			if err != nil {
+				if err == models.ErrNoRecord {
+					next.ServeHTTP(w, r)
+					return
+				}
+				app.serverError(w, r, err)
+				return
+			}
+			user, err := app.users.Get(r.Context(), id)
+			if err != nil {
+				if err == models.ErrNoRecord {
+					next.ServeHTTP(w, r)
+					return
+				}
+				app.serverError(w, r, err)
+				return
+			}
+			if user.Disabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx := context.WithValue(r.Context(), contextKeyUser, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		exists := app.session.Exists(r, "userID")
 		if !exists {
 			next.ServeHTTP(w, r)
 			return
 		}
+		// The cookie only proves who the user is while the server-side
+		// session it names still exists. If it has been revoked or has
+		// expired, log the user out and carry on as an anonymous request.
+		userID := app.session.GetInt(r, "userID")
+		s, err := app.sessionStore.Get(r.Context(), app.session.GetString(r, "sessionToken"))
+		if err == nil && s.UserID != userID {
+			err = models.ErrNoRecord
+		}
+		if err != nil {
+			if err == models.ErrNoRecord {
+				app.endSession(r)
+				next.ServeHTTP(w, r)
+				return
+			}
+			app.serverError(w, r, err)
+			return
+		}
+		if err = app.sessionStore.Touch(r.Context(), s.ID); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
 		// Fetch the details of the current user from the database. If
 		// no matching record is found, remove the (invalid) userID from
 		// their session and call the next handler in the chain as normal.
-		user, err := app.users.Get(app.session.GetInt(r, "userID"))
+		user, err := app.users.Get(r.Context(), userID)
 		if err != nil {
 			if err == models.ErrNoRecord {
-				app.session.Remove(r, "userID")
+				app.endSession(r)
 				next.ServeHTTP(w, r)
 				return
 			}
-			app.serverError(w, err)
+			app.serverError(w, r, err)
+			return
+		}
+		// A user who has been disabled is logged out straight away.
+		if user.Disabled {
+			app.endSession(r)
+			next.ServeHTTP(w, r)
 			return
 		}
 		// Otherwise, we know that the request is coming from a valid,
@@ -92,6 +298,17 @@ func (app application) authenticate(next http.Handler) http.Handler {
 		// call the next handler in the chain *using this new copy of the
 		// request*.
 		ctx := context.WithValue(r.Context(), contextKeyUser, user)
+		ctx = context.WithValue(ctx, contextKeySession, s)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>"
+// request header.
+func bearerToken(r *http.Request) (string, bool) {
+	parts := strings.Fields(r.Header.Get("Authorization"))
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", false
+	}
+	return parts[1], true
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"wilbertopachecob/snippetbox/pkg/jsonlog"
 )
 
 func TestHeaders(t *testing.T) {
@@ -48,3 +51,83 @@ func TestHeaders(t *testing.T) {
 		t.Errorf("want %q, got %q", "OK", string(body))
 	}
 }
+
+func TestRequestID(t *testing.T) {
+	app := &application{logger: jsonlog.New(ioutil.Discard, jsonlog.LevelOff)}
+
+	tests := []struct {
+		name     string
+		incoming string
+		wantKept bool
+	}{
+		{"No incoming ID", "", false},
+		{"Valid incoming ID", "abc-123.def_456", true},
+		{"Invalid incoming ID", "<script>", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = requestID(r)
+			})
+
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.incoming != "" {
+				r.Header.Set("X-Request-ID", tt.incoming)
+			}
+			rr := httptest.NewRecorder()
+			app.requestID(next).ServeHTTP(rr, r)
+
+			id := rr.Header().Get("X-Request-ID")
+			if !validRequestID.MatchString(id) {
+				t.Fatalf("want a valid X-Request-ID header; got %q", id)
+			}
+			if seen != id {
+				t.Errorf("want request ID %q in the context; got %q", id, seen)
+			}
+			if kept := id == tt.incoming; kept != tt.wantKept {
+				t.Errorf("want incoming ID kept %v; got header %q", tt.wantKept, id)
+			}
+		})
+	}
+}
+
+func TestLogRequest(t *testing.T) {
+	var buf bytes.Buffer
+	app := &application{logger: jsonlog.New(&buf, jsonlog.LevelInfo)}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})
+
+	r := httptest.NewRequest("GET", "/snippet/1", nil)
+	r.Header.Set("X-Request-ID", "req-1")
+	app.requestID(app.logRequest(next)).ServeHTTP(httptest.NewRecorder(), r)
+
+	var entry struct {
+		Level      string
+		Message    string
+		Properties map[string]string
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("want a single JSON entry; got %q: %v", buf.String(), err)
+	}
+
+	want := map[string]string{
+		"request_id": "req-1",
+		"method":     "GET",
+		"uri":        "/snippet/1",
+		"status":     "418",
+		"bytes":      "15",
+	}
+	for k, v := range want {
+		if entry.Properties[k] != v {
+			t.Errorf("want %s %q; got %q", k, v, entry.Properties[k])
+		}
+	}
+	if entry.Properties["duration"] == "" {
+		t.Error("want a duration")
+	}
+}
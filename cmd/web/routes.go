@@ -2,34 +2,81 @@ package main
 
 import (
 	"net/http"
+	"wilbertopachecob/snippetbox/pkg/models"
 
 	"github.com/bmizerany/pat"
 	"github.com/justinas/alice"
 )
 
 func (app *application) routes() http.Handler {
-	standardMiddleware := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
+	// The request id is assigned first so that everything after it can log
+	// it, and panics are recovered inside recordMetrics and logRequest so
+	// that the 500 responses they cause are counted and logged too.
+	standardMiddleware := alice.New(app.requestID, app.recordMetrics, app.logRequest, app.recoverPanic, secureHeaders)
 	// Create a new middleware chain containing the middleware specific to
 	// our dynamic application routes. For now, this chain will only contain
 	// the session middleware but we'll add more to it later.
 	dynamicMiddleware := alice.New(app.session.Enable, noSurf, app.authenticate)
+	// The JSON API has its own chain. It skips noSurf, since API clients
+	// don't render our forms and so never have a CSRF token.
+	apiMiddleware := alice.New(app.session.Enable, app.authenticate)
 	//mux := http.NewServeMux()
 	// mux.HandleFunc("/", app.home)
 	// mux.HandleFunc("/snippet", app.showSnippet)
 	// mux.HandleFunc("/snippet/create", app.createSnippet)
 
-	mux := pat.New()
+	// Wrap the router so that the metrics are labelled with the pattern of
+	// the route each request matched.
+	mux := routeMux{pat.New()}
 	mux.Get("/", dynamicMiddleware.ThenFunc(app.home))
+	mux.Get("/search", dynamicMiddleware.ThenFunc(app.search))
 	mux.Get("/snippet/create", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.createSnippetForm))
 	mux.Post("/snippet/create", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.createSnippet))
+	mux.Get("/snippet/:id/edit", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.editSnippetForm))
+	mux.Post("/snippet/:id/edit", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.editSnippet))
+	mux.Post("/snippet/:id/delete", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.deleteSnippet))
 	mux.Get("/snippet/:id", dynamicMiddleware.ThenFunc(app.showSnippet))
+	mux.Get("/s/:slug", dynamicMiddleware.ThenFunc(app.showUnlistedSnippet))
 	mux.Post("/user/logout", dynamicMiddleware.ThenFunc(app.logout))
-	mux.Post("/user/login", dynamicMiddleware.ThenFunc(app.loginUser))
+	mux.Post("/user/login", dynamicMiddleware.Append(app.limitLogins).ThenFunc(app.loginUser))
 	mux.Get("/user/login", dynamicMiddleware.ThenFunc(app.loginUserForm))
+	mux.Get("/user/login/2fa", dynamicMiddleware.ThenFunc(app.verifyLoginForm))
+	mux.Post("/user/login/2fa", dynamicMiddleware.Append(app.limitLogins).ThenFunc(app.verifyLogin))
 	mux.Post("/user/signup", dynamicMiddleware.ThenFunc(app.signupUser))
 	mux.Get("/user/signup", dynamicMiddleware.ThenFunc(app.signupUserForm))
+	mux.Get("/user/password/forgot", dynamicMiddleware.ThenFunc(app.forgotPasswordForm))
+	mux.Post("/user/password/forgot", dynamicMiddleware.ThenFunc(app.forgotPassword))
+	mux.Get("/user/password/reset", dynamicMiddleware.ThenFunc(app.resetPasswordForm))
+	mux.Post("/user/password/reset", dynamicMiddleware.ThenFunc(app.resetPassword))
+	mux.Get("/account", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.accountPage))
+	mux.Post("/account", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.updateAccount))
+	mux.Get("/account/password", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.changePasswordForm))
+	mux.Post("/account/password", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.changePassword))
+	mux.Get("/account/sessions", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.sessionsPage))
+	mux.Post("/account/sessions/delete-all", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.revokeAllSessions))
+	mux.Post("/account/sessions/:id/delete", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.revokeSession))
+	mux.Get("/account/2fa", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.twoFactorPage))
+	mux.Post("/account/2fa/enable", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.enableTwoFactor))
+	mux.Post("/account/2fa/disable", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.disableTwoFactor))
+	mux.Get("/user/tokens", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.tokensPage))
+	mux.Post("/user/tokens", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.createToken))
+	mux.Post("/user/tokens/:id/delete", dynamicMiddleware.Append(app.requiredAuthenticated).ThenFunc(app.revokeToken))
+
+	mux.Get("/admin", dynamicMiddleware.Append(app.requireRole(models.RoleAdmin)).ThenFunc(app.adminUsers))
+	mux.Get("/admin/audit", dynamicMiddleware.Append(app.requireRole(models.RoleAdmin)).ThenFunc(app.adminAudit))
+	mux.Post("/admin/users/:id/disable", dynamicMiddleware.Append(app.requireRole(models.RoleAdmin)).ThenFunc(app.adminDisableUser))
+	mux.Post("/admin/users/:id/enable", dynamicMiddleware.Append(app.requireRole(models.RoleAdmin)).ThenFunc(app.adminEnableUser))
+	mux.Post("/admin/snippets/:id/delete", dynamicMiddleware.Append(app.requireRole(models.RoleModerator)).ThenFunc(app.adminDeleteSnippet))
+
+	mux.Get("/api/v1/snippets", apiMiddleware.ThenFunc(app.apiListSnippets))
+	mux.Post("/api/v1/snippets", apiMiddleware.Append(app.requiredAPIAuthenticated).ThenFunc(app.apiCreateSnippet))
+	mux.Get("/api/v1/snippets/:id", apiMiddleware.ThenFunc(app.apiShowSnippet))
+
 	//just for testing purposes
 	mux.Get("/ping", http.HandlerFunc(ping))
+	if app.metricsAddr == "" {
+		mux.Get("/metrics", app.metrics.registry.Handler())
+	}
 	// Create a file server which serves files out of the "./ui/static" directo
 	// Note that the path given to the http.Dir function is relative to the pro
 	// directory root.
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve runs the HTTPS server until it fails or the process receives SIGINT
+// or SIGTERM. On a signal the server stops accepting connections and gives
+// in-flight requests up to timeout to complete before returning.
+func (app *application) serve(srv *http.Server, certFile, keyFile string, timeout time.Duration) error {
+	shutdownErr := make(chan error, 1)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+		signal.Stop(quit)
+
+		app.logger.PrintInfo("shutting down server", map[string]string{"signal": s.String()})
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		shutdownErr <- srv.Shutdown(ctx)
+	}()
+
+	// ListenAndServeTLS returns http.ErrServerClosed as soon as Shutdown is
+	// called, so that error just means we have to wait for the shutdown to
+	// finish draining connections.
+	err := srv.ListenAndServeTLS(certFile, keyFile)
+	if err != http.ErrServerClosed {
+		return err
+	}
+	return <-shutdownErr
+}
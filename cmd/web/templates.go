@@ -1,17 +1,42 @@
 package main
 
 import (
+	"html"
+	"html/template"
 	"path/filepath"
-	"text/template"
+	"regexp"
+	"strings"
 	"time"
 	"wilbertopachecob/snippetbox/pkg/forms"
 	"wilbertopachecob/snippetbox/pkg/models"
+
+	"github.com/alecthomas/chroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
 )
 
 type templateData struct {
 	AuthenticatedUser *models.User
 	Snippet           *models.Snippet
 	Snippets          []*models.Snippet
+	Pagination        *pagination
+	Query             string
+	Users             []*models.User
+	AuditEvents       []*models.AuditEvent
+	Tokens            []*models.Token
+	NewToken          string
+	// The state of two-factor authentication on its settings page. While it
+	// is disabled TOTPSecret and TOTPURI hold the secret being set up. The
+	// otpauth scheme isn't one html/template trusts, so TOTPURI is a
+	// template.URL to be usable as a link.
+	TwoFactorEnabled  bool
+	TOTPSecret        string
+	TOTPURI           template.URL
+	RecoveryCodes     []string
+	RecoveryCodesLeft int
+	Sessions          []*models.Session
+	CurrentSessionID  int
 	CurrentYear       int
 	Flash             string
 	Form              *forms.Form
@@ -26,11 +51,102 @@ func humanDate(t time.Time) string {
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// highlight HTML-escapes text and wraps every case-insensitive occurrence of
+// the words in q with a <mark> element. The result is returned as
+// template.HTML so that html/template doesn't escape the markup again.
+func highlight(text, q string) template.HTML {
+	terms := strings.Fields(q)
+	if len(terms) == 0 {
+		return template.HTML(html.EscapeString(text))
+	}
+	for i, term := range terms {
+		terms[i] = regexp.QuoteMeta(term)
+	}
+	rx := regexp.MustCompile("(?i)" + strings.Join(terms, "|"))
+
+	// Escape the text between and inside the matches separately, so that a
+	// search term can never match part of an HTML entity.
+	var b strings.Builder
+	last := 0
+	for _, loc := range rx.FindAllStringIndex(text, -1) {
+		b.WriteString(html.EscapeString(text[last:loc[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[loc[0]:loc[1]]))
+		b.WriteString("</mark>")
+		last = loc[1]
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return template.HTML(b.String())
+}
+
+// language is a programming language a snippet can be tagged with. Name is
+// the chroma lexer name, which is what gets stored in the database, and Label
+// is what we show on the forms.
+type language struct {
+	Name  string
+	Label string
+}
+
+var snippetLanguages = []language{
+	{"plaintext", "Plain text"},
+	{"go", "Go"},
+	{"python", "Python"},
+	{"javascript", "JavaScript"},
+	{"sql", "SQL"},
+	{"bash", "Bash"},
+	{"html", "HTML"},
+	{"css", "CSS"},
+	{"json", "JSON"},
+	{"yaml", "YAML"},
+}
+
+func languages() []language {
+	return snippetLanguages
+}
+
+// languageNames returns the names of all the supported languages, for use
+// with forms.PermitedValues.
+func languageNames() []string {
+	names := make([]string, len(snippetLanguages))
+	for i, l := range snippetLanguages {
+		names[i] = l.Name
+	}
+	return names
+}
+
+// highlightCode renders content as syntax highlighted HTML for the given
+// language. Styles are written inline so that no extra stylesheet is needed.
+// Unknown languages are rendered as plain text. chroma escapes the content
+// itself, so the result is safe to return as template.HTML.
+func highlightCode(content, language string) (template.HTML, error) {
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	iterator, err := lexer.Tokenise(nil, content)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	formatter := chromahtml.New(chromahtml.WithClasses(false))
+	err = formatter.Format(&b, styles.Get("github"), iterator)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(b.String()), nil
+}
+
 // Initialize a template.FuncMap object and store it in a global variable. This
 // essentially a string-keyed map which acts as a lookup between the names of o
 // custom template functions and the functions themselves.
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":     humanDate,
+	"highlight":     highlight,
+	"highlightCode": highlightCode,
+	"languages":     languages,
 }
 
 func newTemplateCache(dir string) (map[string]*template.Template, error) {
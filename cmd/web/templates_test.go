@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 	"time"
 )
@@ -58,3 +59,56 @@ func TestHumanDate(t *testing.T) {
 		})
 	}
 }
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		q    string
+		want string
+	}{
+		{"No query", "An old pond", "", "An old pond"},
+		{"Single term", "An old pond", "pond", "An old <mark>pond</mark>"},
+		{"Case insensitive", "Old pond, old frog", "OLD", "<mark>Old</mark> pond, <mark>old</mark> frog"},
+		{"Several terms", "An old pond", "old pond", "An <mark>old</mark> <mark>pond</mark>"},
+		{"Escapes text", "<b>pond</b>", "pond", "&lt;b&gt;<mark>pond</mark>&lt;/b&gt;"},
+		{"Regexp characters", "1+1 = 2", "1+1", "<mark>1+1</mark> = 2"},
+		{"Does not match entities", "a & b", "amp", "a &amp; b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(highlight(tt.text, tt.q))
+			if got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHighlightCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		language string
+		want     []string
+	}{
+		{"Go", "package main", "go", []string{"<pre", "<span style=", "package", "main"}},
+		{"Escapes content", "if a < b {}", "go", []string{"&lt;"}},
+		{"Unknown language", "<b>text</b>", "nosuchlanguage", []string{"&lt;b&gt;text&lt;/b&gt;"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := highlightCode(tt.content, tt.language)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(got), want) {
+					t.Errorf("want %q to contain %q", got, want)
+				}
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"html"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
@@ -11,6 +10,8 @@ import (
 	"regexp"
 	"testing"
 	"time"
+	"wilbertopachecob/snippetbox/pkg/jsonlog"
+	"wilbertopachecob/snippetbox/pkg/mailer"
 	"wilbertopachecob/snippetbox/pkg/models/mock"
 
 	"github.com/golangcollege/sessions"
@@ -31,12 +32,20 @@ func newTestApplication(t *testing.T) *application {
 	session.Secure = true
 
 	return &application{
-		infolog:       log.New(ioutil.Discard, "", 0),
-		errorlog:      log.New(ioutil.Discard, "", 0),
+		logger:        jsonlog.New(ioutil.Discard, jsonlog.LevelOff),
 		snippets:      &mock.SnippetModel{},
 		users:         &mock.UserModel{},
+		audit:         &mock.AuditModel{},
+		twoFactor:     &mock.TwoFactorModel{},
+		sessionStore:  &mock.SessionModel{},
+		tokens:        &mock.TokenModel{},
+		resets:        &mock.ResetTokenModel{},
 		templateCache: templateCache,
 		session:       session,
+		mailer:        &mailer.MemoryMailer{},
+		metrics:       newAppMetrics(),
+		loginLimits:   newLoginLimits(),
+		baseURL:       "https://snippetbox.test",
 	}
 }
 
@@ -119,3 +128,19 @@ func extractCSRFToken(t *testing.T, body []byte) string {
 	}
 	return html.UnescapeString(string(matches[1]))
 }
+
+// Create a login helper which signs in as the mock user, so that tests can
+// exercise routes protected by the requiredAuthenticated middleware. The
+// session cookie is stored in the test server client's cookie jar.
+func (tls *testServer) login(t *testing.T, email, password string) {
+	_, _, body := tls.get(t, "/user/login")
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", password)
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := tls.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login: want %d; got %d", http.StatusSeeOther, code)
+	}
+}
@@ -1,13 +1,16 @@
 module wilbertopachecob/snippetbox
 
-go 1.15
+go 1.16
 
 require (
-	github.com/bmizerany/pat v0.0.0-20170815010413-6226ea591a40 // indirect
-	github.com/go-sql-driver/mysql v1.6.0 // indirect
-	github.com/golangcollege/sessions v1.2.0 // indirect
+	github.com/alecthomas/chroma v0.10.0
+	github.com/bmizerany/pat v0.0.0-20170815010413-6226ea591a40
+	github.com/go-sql-driver/mysql v1.6.0
+	github.com/golangcollege/sessions v1.2.0
 	github.com/joho/godotenv v1.3.0
-	github.com/justinas/alice v1.2.0 // indirect
-	github.com/justinas/nosurf v1.1.1 // indirect
-	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2 // indirect
+	github.com/justinas/alice v1.2.0
+	github.com/justinas/nosurf v1.1.1
+	github.com/mattn/go-sqlite3 v1.14.22
+	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
+	gopkg.in/yaml.v2 v2.4.0
 )
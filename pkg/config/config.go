@@ -0,0 +1,367 @@
+// Package config loads the settings shared by the web server and the CLI.
+//
+// Every setting has a default and can be overridden, in increasing order of
+// precedence, by an optional YAML config file, by an environment variable and
+// by a command-line flag. Variables in a .env file in the working directory
+// are loaded into the environment first, without replacing any variable that
+// is already set.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/jsonlog"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds every setting of the application.
+type Config struct {
+	Addr            string        `yaml:"addr"`
+	MetricsAddr     string        `yaml:"metrics_addr"`
+	BaseURL         string        `yaml:"base_url"`
+	CookieSecret    string        `yaml:"cookie_secret"`
+	SessionLifetime time.Duration `yaml:"session_lifetime"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	QueryTimeout    time.Duration `yaml:"query_timeout"`
+	PurgeInterval   time.Duration `yaml:"purge_interval"`
+	// LoginMaxFailures failed logins in a row lock an account for
+	// LoginLockout. Zero disables the lockout.
+	LoginMaxFailures int           `yaml:"login_max_failures"`
+	LoginLockout     time.Duration `yaml:"login_lockout"`
+	MailDir          string        `yaml:"mail_dir"`
+	LogLevel         string        `yaml:"log_level"`
+	DB               DB            `yaml:"db"`
+	TLS              TLS           `yaml:"tls"`
+	SMTP             SMTP          `yaml:"smtp"`
+}
+
+// DB holds the settings used to connect to the database. With the sqlite
+// driver Database is the path of the database file and the other fields are
+// ignored.
+type DB struct {
+	Driver   string `yaml:"driver"`
+	Host     string `yaml:"host"`
+	Database string `yaml:"database"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Drivers supported by the models, as accepted by -db-driver.
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+)
+
+// DriverName returns the name the database/sql driver for d.Driver is
+// registered under.
+func (d DB) DriverName() string {
+	if d.Driver == DriverSQLite {
+		return "sqlite3"
+	}
+	return d.Driver
+}
+
+// DSN returns the data source name for the configured driver. Without a host
+// the MySQL driver connects to localhost:3306. SQLite connections enforce
+// foreign keys, wait for locks instead of failing straight away and take the
+// write lock when a transaction begins, which the sqlite models rely on.
+func (d DB) DSN() string {
+	if d.Driver == DriverSQLite {
+		return "file:" + d.Database + "?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate"
+	}
+
+	addr := ""
+	if d.Host != "" {
+		addr = "tcp(" + d.Host + ")"
+	}
+	return fmt.Sprintf("%s:%s@%s/%s?parseTime=true", d.Username, d.Password, addr, d.Database)
+}
+
+// TLS holds the paths of the certificate and key the server is served with.
+type TLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// SMTP holds the settings of the server emails are sent through. When Host is
+// empty emails are written to MailDir instead.
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// Default returns the configuration used when nothing is overridden.
+func Default() *Config {
+	return &Config{
+		Addr:             ":4000",
+		SessionLifetime:  time.Hour,
+		IdleTimeout:      time.Minute,
+		ReadTimeout:      5 * time.Second,
+		WriteTimeout:     10 * time.Second,
+		ShutdownTimeout:  30 * time.Second,
+		QueryTimeout:     3 * time.Second,
+		LoginMaxFailures: 5,
+		LoginLockout:     15 * time.Minute,
+		PurgeInterval:    time.Hour,
+		MailDir:          "./tpm/mail",
+		LogLevel:         "info",
+		DB:               DB{Driver: DriverMySQL},
+		TLS: TLS{
+			CertFile: "./tls/cert.pem",
+			KeyFile:  "./tls/key.pem",
+		},
+		SMTP: SMTP{Port: 587},
+	}
+}
+
+// setting describes how a single field can be set from a flag and from an
+// environment variable. value returns a pointer to the field, which must be a
+// *string, *int or *time.Duration.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	value func(c *Config) interface{}
+}
+
+var settings = []setting{
+	{"addr", "ADDR", "HTTP network address", func(c *Config) interface{} { return &c.Addr }},
+	{"metrics-addr", "METRICS_ADDR", "Separate plain HTTP address to serve /metrics on (default serve it on -addr)", func(c *Config) interface{} { return &c.MetricsAddr }},
+	{"base-url", "BASE_URL", "Scheme and host used to build absolute links (default https://localhost followed by -addr)", func(c *Config) interface{} { return &c.BaseURL }},
+	{"cookie-secret", "COOKIE_SECRET", "Secret key used to sign and encrypt session cookies", func(c *Config) interface{} { return &c.CookieSecret }},
+	{"session-lifetime", "SESSION_LIFETIME", "How long a session lasts", func(c *Config) interface{} { return &c.SessionLifetime }},
+	{"idle-timeout", "IDLE_TIMEOUT", "How long to keep idle connections open", func(c *Config) interface{} { return &c.IdleTimeout }},
+	{"read-timeout", "READ_TIMEOUT", "How long to wait for a request to be read", func(c *Config) interface{} { return &c.ReadTimeout }},
+	{"write-timeout", "WRITE_TIMEOUT", "How long to wait for a response to be written", func(c *Config) interface{} { return &c.WriteTimeout }},
+	{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "How long to wait for in-flight requests when shutting down", func(c *Config) interface{} { return &c.ShutdownTimeout }},
+	{"query-timeout", "QUERY_TIMEOUT", "How long a single database query may take", func(c *Config) interface{} { return &c.QueryTimeout }},
+	{"purge-interval", "PURGE_INTERVAL", "How often to delete expired snippets (0 disables it)", func(c *Config) interface{} { return &c.PurgeInterval }},
+	{"login-max-failures", "LOGIN_MAX_FAILURES", "Number of failed logins in a row which lock an account (0 disables it)", func(c *Config) interface{} { return &c.LoginMaxFailures }},
+	{"login-lockout", "LOGIN_LOCKOUT", "How long an account stays locked after too many failed logins", func(c *Config) interface{} { return &c.LoginLockout }},
+	{"mail-dir", "MAIL_DIR", "Directory emails are written to when no SMTP server is configured", func(c *Config) interface{} { return &c.MailDir }},
+	{"log-level", "LOG_LEVEL", "Minimum level of the entries logged: debug, info, error or off", func(c *Config) interface{} { return &c.LogLevel }},
+	{"db-driver", "DB_DRIVER", "Database driver, mysql or sqlite", func(c *Config) interface{} { return &c.DB.Driver }},
+	{"db-host", "DB_HOST", "Database host", func(c *Config) interface{} { return &c.DB.Host }},
+	{"db-name", "DB_DATABASE", "Database name, or the path of the database file for sqlite", func(c *Config) interface{} { return &c.DB.Database }},
+	{"db-user", "DB_USERNAME", "Database user", func(c *Config) interface{} { return &c.DB.Username }},
+	{"db-password", "DB_PASSWORD", "Database password", func(c *Config) interface{} { return &c.DB.Password }},
+	{"tls-cert", "TLS_CERT_FILE", "Path to the TLS certificate", func(c *Config) interface{} { return &c.TLS.CertFile }},
+	{"tls-key", "TLS_KEY_FILE", "Path to the TLS private key", func(c *Config) interface{} { return &c.TLS.KeyFile }},
+	{"smtp-host", "SMTP_HOST", "SMTP server host", func(c *Config) interface{} { return &c.SMTP.Host }},
+	{"smtp-port", "SMTP_PORT", "SMTP server port", func(c *Config) interface{} { return &c.SMTP.Port }},
+	{"smtp-user", "SMTP_USERNAME", "SMTP user", func(c *Config) interface{} { return &c.SMTP.Username }},
+	{"smtp-password", "SMTP_PASSWORD", "SMTP password", func(c *Config) interface{} { return &c.SMTP.Password }},
+	{"smtp-from", "SMTP_FROM", "Sender address of emails", func(c *Config) interface{} { return &c.SMTP.From }},
+}
+
+// set parses v and stores it in the field of c the setting refers to.
+func (s setting) set(c *Config, v string) error {
+	switch p := s.value(c).(type) {
+	case *string:
+		*p = v
+	case *int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid value %q: must be an integer", v)
+		}
+		*p = n
+	case *time.Duration:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid value %q: must be a duration such as 30s or 1h", v)
+		}
+		*p = d
+	}
+	return nil
+}
+
+// get returns the value of the field of c the setting refers to as a string.
+func (s setting) get(c *Config) string {
+	switch p := s.value(c).(type) {
+	case *string:
+		return *p
+	case *int:
+		return strconv.Itoa(*p)
+	case *time.Duration:
+		return p.String()
+	}
+	return ""
+}
+
+// RegisterFlags defines a flag for every setting on fs, plus a -config flag
+// for the path of the config file. It must be called before fs is parsed.
+func RegisterFlags(fs *flag.FlagSet) {
+	def := Default()
+	fs.String("config", "", "Path to a YAML config file (env CONFIG_FILE)")
+	for _, s := range settings {
+		fs.String(s.flag, s.get(def), fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+}
+
+// Load builds the configuration from the defaults, the config file, the
+// environment and the flags of fs that were set explicitly. fs must have been
+// set up with RegisterFlags and already parsed. The result is not validated;
+// call Validate or ValidateServer for that.
+func Load(fs *flag.FlagSet) (*Config, error) {
+	err := godotenv.Load(".env")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("config: loading .env: %w", err)
+	}
+
+	explicit := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+
+	c := Default()
+
+	path, ok := explicit["config"]
+	if !ok {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+		err = yaml.UnmarshalStrict(b, c)
+		if err != nil {
+			return nil, fmt.Errorf("config: parsing %s: %w", path, err)
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok && v != "" {
+			err := s.set(c, v)
+			if err != nil {
+				return nil, fmt.Errorf("config: %s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := explicit[s.flag]; ok {
+			err := s.set(c, v)
+			if err != nil {
+				return nil, fmt.Errorf("config: -%s: %w", s.flag, err)
+			}
+		}
+	}
+
+	if c.BaseURL == "" {
+		c.BaseURL = "https://localhost" + c.Addr
+	}
+
+	return c, nil
+}
+
+// ValidationError lists every problem found with a configuration.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e, "; ")
+}
+
+// Validate checks the settings needed by every command, which are those used
+// to connect to the database.
+func (c *Config) Validate() error {
+	var errs ValidationError
+	switch c.DB.Driver {
+	case DriverMySQL:
+		if c.DB.Database == "" {
+			errs = append(errs, "the database name must be set (DB_DATABASE)")
+		}
+		if c.DB.Username == "" {
+			errs = append(errs, "the database user must be set (DB_USERNAME)")
+		}
+	case DriverSQLite:
+		if c.DB.Database == "" {
+			errs = append(errs, "the path of the database file must be set (DB_DATABASE)")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("unknown database driver %q, must be mysql or sqlite (DB_DRIVER)", c.DB.Driver))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValidateServer checks every setting used by the web server.
+func (c *Config) ValidateServer() error {
+	var errs ValidationError
+	if err := c.Validate(); err != nil {
+		errs = append(errs, err.(ValidationError)...)
+	}
+
+	if c.Addr == "" {
+		errs = append(errs, "the address must be set (ADDR)")
+	}
+	if c.MetricsAddr != "" && c.MetricsAddr == c.Addr {
+		errs = append(errs, "the metrics address must differ from the address (METRICS_ADDR)")
+	}
+	if len(c.CookieSecret) < 32 {
+		errs = append(errs, "the cookie secret must be at least 32 bytes long (COOKIE_SECRET)")
+	}
+	if u, err := url.Parse(c.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, "the base URL must be an absolute URL such as https://example.com (BASE_URL)")
+	}
+	if _, err := jsonlog.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, "the log level must be debug, info, error or off (LOG_LEVEL)")
+	}
+	if c.TLS.CertFile == "" || c.TLS.KeyFile == "" {
+		errs = append(errs, "the TLS certificate and key must be set (TLS_CERT_FILE, TLS_KEY_FILE)")
+	}
+
+	durations := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"SESSION_LIFETIME", c.SessionLifetime},
+		{"IDLE_TIMEOUT", c.IdleTimeout},
+		{"READ_TIMEOUT", c.ReadTimeout},
+		{"WRITE_TIMEOUT", c.WriteTimeout},
+		{"SHUTDOWN_TIMEOUT", c.ShutdownTimeout},
+		{"QUERY_TIMEOUT", c.QueryTimeout},
+	}
+	for _, d := range durations {
+		if d.d <= 0 {
+			errs = append(errs, fmt.Sprintf("%s must be positive", d.name))
+		}
+	}
+	if c.PurgeInterval < 0 {
+		errs = append(errs, "PURGE_INTERVAL must not be negative")
+	}
+	if c.LoginMaxFailures < 0 {
+		errs = append(errs, "LOGIN_MAX_FAILURES must not be negative")
+	} else if c.LoginMaxFailures > 0 && c.LoginLockout <= 0 {
+		errs = append(errs, "LOGIN_LOCKOUT must be positive when LOGIN_MAX_FAILURES is set")
+	}
+
+	if c.SMTP.Host != "" && (c.SMTP.Port < 1 || c.SMTP.Port > 65535) {
+		errs = append(errs, "the SMTP port must be between 1 and 65535 (SMTP_PORT)")
+	}
+	if c.SMTP.Host == "" && c.MailDir == "" {
+		errs = append(errs, "either an SMTP host or a mail directory must be set (SMTP_HOST, MAIL_DIR)")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFlagSet(t *testing.T, args ...string) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snippetbox.yml")
+	file := `
+addr: ":5000"
+read_timeout: 7s
+db:
+  database: from_file
+  username: file_user
+smtp:
+  port: 2525
+`
+	if err := ioutil.WriteFile(path, []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("DB_DATABASE", "from_env")
+	t.Setenv("ADDR", ":6000")
+
+	c, err := Load(newFlagSet(t, "-addr", ":7000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"Default", c.WriteTimeout, 10 * time.Second},
+		{"File over default", c.ReadTimeout, 7 * time.Second},
+		{"File nested", c.SMTP.Port, 2525},
+		{"Env over file", c.DB.Database, "from_env"},
+		{"File without env", c.DB.Username, "file_user"},
+		{"Flag over env", c.Addr, ":7000"},
+		{"Derived base URL", c.BaseURL, "https://localhost:7000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("want %v; got %v", tt.want, tt.got)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"Invalid env duration", map[string]string{"READ_TIMEOUT": "soon"}, nil, "READ_TIMEOUT"},
+		{"Invalid flag integer", nil, []string{"-smtp-port", "abc"}, "-smtp-port"},
+		{"Missing config file", nil, []string{"-config", "does-not-exist.yml"}, "does-not-exist.yml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := Load(newFlagSet(t, tt.args...))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("want error containing %q; got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateServer(t *testing.T) {
+	valid := func() *Config {
+		c := Default()
+		c.BaseURL = "https://localhost:4000"
+		c.CookieSecret = strings.Repeat("s", 32)
+		c.DB.Database = "snippetbox"
+		c.DB.Username = "web"
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string
+	}{
+		{"Valid", func(c *Config) {}, ""},
+		{"Missing database", func(c *Config) { c.DB.Database = "" }, "DB_DATABASE"},
+		{"SQLite without user", func(c *Config) { c.DB.Driver = DriverSQLite; c.DB.Username = "" }, ""},
+		{"Unknown driver", func(c *Config) { c.DB.Driver = "oracle" }, "DB_DRIVER"},
+		{"Separate metrics address", func(c *Config) { c.MetricsAddr = "localhost:9100" }, ""},
+		{"Metrics on the same address", func(c *Config) { c.MetricsAddr = c.Addr }, "METRICS_ADDR"},
+		{"Short secret", func(c *Config) { c.CookieSecret = "short" }, "COOKIE_SECRET"},
+		{"Relative base URL", func(c *Config) { c.BaseURL = "/snippets" }, "BASE_URL"},
+		{"Unknown log level", func(c *Config) { c.LogLevel = "verbose" }, "LOG_LEVEL"},
+		{"Zero timeout", func(c *Config) { c.WriteTimeout = 0 }, "WRITE_TIMEOUT"},
+		{"Negative purge interval", func(c *Config) { c.PurgeInterval = -time.Second }, "PURGE_INTERVAL"},
+		{"Lockout disabled", func(c *Config) { c.LoginMaxFailures = 0; c.LoginLockout = 0 }, ""},
+		{"Zero lockout", func(c *Config) { c.LoginLockout = 0 }, "LOGIN_LOCKOUT"},
+		{"Invalid SMTP port", func(c *Config) { c.SMTP.Host = "smtp.example.com"; c.SMTP.Port = 0 }, "SMTP_PORT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.modify(c)
+			err := c.ValidateServer()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("want no error; got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("want error containing %q; got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Package jsonlog provides a leveled logger which writes each entry as a
+// single line of JSON.
+package jsonlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry.
+type Level int8
+
+// The levels, in increasing order of severity. A logger with LevelOff as its
+// minimum level writes nothing.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelError
+	LevelFatal
+	LevelOff
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelError:
+		return "ERROR"
+	case LevelFatal:
+		return "FATAL"
+	default:
+		return ""
+	}
+}
+
+// ParseLevel returns the level with the given name, such as "info". Case is
+// ignored.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "error":
+		return LevelError, nil
+	case "fatal":
+		return LevelFatal, nil
+	case "off":
+		return LevelOff, nil
+	default:
+		return 0, fmt.Errorf("jsonlog: unknown level %q", s)
+	}
+}
+
+// Logger writes entries at or above its minimum level to an io.Writer. It is
+// safe for concurrent use.
+type Logger struct {
+	out      io.Writer
+	minLevel Level
+	mu       sync.Mutex
+}
+
+// New returns a logger which writes entries at or above minLevel to out.
+func New(out io.Writer, minLevel Level) *Logger {
+	return &Logger{out: out, minLevel: minLevel}
+}
+
+// PrintDebug writes a DEBUG entry.
+func (l *Logger) PrintDebug(message string, properties map[string]string) {
+	l.print(LevelDebug, message, properties)
+}
+
+// PrintInfo writes an INFO entry.
+func (l *Logger) PrintInfo(message string, properties map[string]string) {
+	l.print(LevelInfo, message, properties)
+}
+
+// PrintError writes an ERROR entry, including a stack trace.
+func (l *Logger) PrintError(err error, properties map[string]string) {
+	l.print(LevelError, err.Error(), properties)
+}
+
+// PrintFatal writes a FATAL entry, including a stack trace, and then
+// terminates the program.
+func (l *Logger) PrintFatal(err error, properties map[string]string) {
+	l.print(LevelFatal, err.Error(), properties)
+	os.Exit(1)
+}
+
+func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
+	if level < l.minLevel {
+		return 0, nil
+	}
+
+	aux := struct {
+		Level      string            `json:"level"`
+		Time       string            `json:"time"`
+		Message    string            `json:"message"`
+		Properties map[string]string `json:"properties,omitempty"`
+		Trace      string            `json:"trace,omitempty"`
+	}{
+		Level:      level.String(),
+		Time:       time.Now().UTC().Format(time.RFC3339),
+		Message:    message,
+		Properties: properties,
+	}
+	if level >= LevelError {
+		aux.Trace = string(debug.Stack())
+	}
+
+	line, err := json.Marshal(aux)
+	if err != nil {
+		line = []byte(LevelError.String() + ": unable to marshal log message: " + err.Error())
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.out.Write(append(line, '\n'))
+}
+
+// Write writes message as an ERROR entry with no properties. It lets the
+// logger be used as the output of a standard library *log.Logger, such as the
+// ErrorLog of an http.Server.
+func (l *Logger) Write(message []byte) (int, error) {
+	return l.print(LevelError, strings.TrimSpace(string(message)), nil)
+}
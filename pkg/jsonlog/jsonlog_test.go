@@ -0,0 +1,72 @@
+package jsonlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, LevelInfo)
+
+	l.PrintDebug("hidden", nil)
+	l.PrintInfo("request completed", map[string]string{"status": "200"})
+	l.PrintError(errors.New("boom"), nil)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("want 2 entries; got %d: %s", len(lines), buf.String())
+	}
+
+	var entry struct {
+		Level      string
+		Message    string
+		Properties map[string]string
+		Trace      string
+	}
+	if err := json.Unmarshal(lines[0], &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Level != "INFO" || entry.Message != "request completed" || entry.Properties["status"] != "200" {
+		t.Errorf("unexpected entry %s", lines[0])
+	}
+	if entry.Trace != "" {
+		t.Errorf("want no trace for INFO entries")
+	}
+
+	entry.Properties = nil
+	if err := json.Unmarshal(lines[1], &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Level != "ERROR" || entry.Message != "boom" || entry.Trace == "" {
+		t.Errorf("unexpected entry %s", lines[1])
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Level
+		wantErr bool
+	}{
+		{"debug", LevelDebug, false},
+		{"INFO", LevelInfo, false},
+		{"error", LevelError, false},
+		{"off", LevelOff, false},
+		{"verbose", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLevel(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("want error %v; got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("want %v; got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.NewCounterVec("requests_total", "Requests handled.", "route", "status")
+	errors := reg.NewCounterVec("errors_total", "Errors.")
+	latency := reg.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	reg.NewGaugeFunc("connections", "Open connections.", func() float64 { return 3 })
+
+	requests.Inc("/snippet/:id", "200")
+	requests.Inc("/snippet/:id", "200")
+	requests.Inc(`/"quoted"`, "404")
+	latency.Observe(0.05, "/")
+	latency.Observe(0.5, "/")
+
+	var buf bytes.Buffer
+	reg.WriteText(&buf)
+
+	want := []string{
+		"# HELP requests_total Requests handled.\n# TYPE requests_total counter\n",
+		`requests_total{route="/snippet/:id",status="200"} 2` + "\n",
+		`requests_total{route="/\"quoted\"",status="404"} 1` + "\n",
+		"# TYPE errors_total counter\nerrors_total 0\n",
+		"# TYPE latency_seconds histogram\n",
+		`latency_seconds_bucket{route="/",le="0.1"} 1` + "\n",
+		`latency_seconds_bucket{route="/",le="1"} 2` + "\n",
+		`latency_seconds_bucket{route="/",le="+Inf"} 2` + "\n",
+		`latency_seconds_sum{route="/"} 0.55` + "\n",
+		`latency_seconds_count{route="/"} 2` + "\n",
+		"# TYPE connections gauge\nconnections 3\n",
+	}
+	for _, w := range want {
+		if !strings.Contains(buf.String(), w) {
+			t.Errorf("want output to contain %q; got:\n%s", w, buf.String())
+		}
+	}
+
+	if v := requests.Value("/snippet/:id", "200"); v != 2 {
+		t.Errorf("want value 2; got %v", v)
+	}
+	if v := errors.Value(); v != 0 {
+		t.Errorf("want value 0; got %v", v)
+	}
+}
+
+func TestRegistryPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(reg *Registry)
+	}{
+		{"Duplicate name", func(reg *Registry) {
+			reg.NewCounterVec("a_total", "")
+			reg.NewCounterVec("a_total", "")
+		}},
+		{"Wrong number of labels", func(reg *Registry) {
+			reg.NewCounterVec("a_total", "", "route").Inc()
+		}},
+		{"Negative counter", func(reg *Registry) {
+			reg.NewCounterVec("a_total", "").Add(-1)
+		}},
+		{"Unsorted buckets", func(reg *Registry) {
+			reg.NewHistogramVec("a_seconds", "", []float64{1, 0.1})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("want a panic")
+				}
+			}()
+			tt.fn(NewRegistry())
+		})
+	}
+}
@@ -0,0 +1,262 @@
+// Package migrations applies the versioned database schema.
+//
+// The migrations for each driver are SQL files embedded from a directory
+// named after it, such as mysql/0002_create_snippets.up.sql. The number at
+// the start of the file name is the version, which orders the migrations,
+// and every .up.sql file must have a matching .down.sql file which undoes it.
+// Statements are separated by a semicolon at the end of a line.
+//
+// The versions that have been applied are recorded in the schema_migrations
+// table, so that running the migrations again only applies the new ones.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed mysql/*.sql sqlite/*.sql
+var files embed.FS
+
+// Migration is a single change to the schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes whether a migration has been applied, and when.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// ErrNoApplied is returned by Down when there is no migration to revert.
+var ErrNoApplied = errors.New("migrations: no migration has been applied")
+
+// Load returns the migrations for the given driver, ordered by version.
+func Load(driver string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, driver)
+	if err != nil {
+		return nil, fmt.Errorf("migrations: no migrations for driver %q", driver)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migrations: %s: must end in .up.sql or .down.sql", name)
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		i := strings.Index(base, "_")
+		if i < 1 {
+			return nil, fmt.Errorf("migrations: %s: must start with a version followed by an underscore", name)
+		}
+		version, err := strconv.Atoi(base[:i])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migrations: %s: invalid version %q", name, base[:i])
+		}
+
+		b, err := files.ReadFile(path.Join(driver, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: base[i+1:]}
+			byVersion[version] = m
+		} else if m.Name != base[i+1:] {
+			return nil, fmt.Errorf("migrations: version %d is used by both %s and %s", version, m.Name, base[i+1:])
+		}
+		if direction == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrations: version %d (%s) needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// statements splits the contents of a migration file into the statements it
+// contains, leaving out comment lines.
+func statements(content string) []string {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+
+	var stmts []string
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";\n") {
+		stmt = strings.TrimSuffix(strings.TrimSpace(stmt), ";")
+		if stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
+// Migrator applies and reverts the migrations of a driver on a database.
+type Migrator struct {
+	DB     *sql.DB
+	Driver string
+}
+
+// init creates the schema_migrations table if it doesn't exist yet.
+func (m *Migrator) init() error {
+	_, err := m.DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied DATETIME NOT NULL
+	)`)
+	return err
+}
+
+// applied returns the time each applied version was applied at.
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	err := m.init()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.Query(`SELECT version, applied FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err = rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// run executes the statements of a migration and records the change in
+// schema_migrations, in a single transaction. MySQL commits DDL statements
+// straight away, so there a failing migration may be left half applied and
+// need fixing by hand.
+func (m *Migrator) run(content, record string, args ...interface{}) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range statements(content) {
+		if _, err = tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.Exec(record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Up applies every migration that hasn't been applied yet, in order, and
+// returns them. It stops at the first one that fails.
+func (m *Migrator) Up() ([]Migration, error) {
+	migrations, err := Load(m.Driver)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mg := range migrations {
+		if _, ok := applied[mg.Version]; ok {
+			continue
+		}
+		err = m.run(mg.Up, `INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)`,
+			mg.Version, mg.Name, time.Now().UTC().Truncate(time.Second))
+		if err != nil {
+			return done, fmt.Errorf("migrations: applying %04d_%s: %w", mg.Version, mg.Name, err)
+		}
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// Down reverts the most recently applied migration and returns it. If no
+// migration has been applied we return ErrNoApplied.
+func (m *Migrator) Down() (*Migration, error) {
+	migrations, err := Load(m.Driver)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		mg := migrations[i]
+		if _, ok := applied[mg.Version]; !ok {
+			continue
+		}
+		err = m.run(mg.Down, `DELETE FROM schema_migrations WHERE version = ?`, mg.Version)
+		if err != nil {
+			return nil, fmt.Errorf("migrations: reverting %04d_%s: %w", mg.Version, mg.Name, err)
+		}
+		return &mg, nil
+	}
+	return nil, ErrNoApplied
+}
+
+// Status returns every migration along with whether it has been applied.
+func (m *Migrator) Status() ([]Status, error) {
+	migrations, err := Load(m.Driver)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]Status, len(migrations))
+	for i, mg := range migrations {
+		at, ok := applied[mg.Version]
+		status[i] = Status{Migration: mg, Applied: ok, AppliedAt: at}
+	}
+	return status, nil
+}
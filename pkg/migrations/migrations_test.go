@@ -0,0 +1,219 @@
+package migrations
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestLoad(t *testing.T) {
+	for _, driver := range []string{"mysql", "sqlite"} {
+		t.Run(driver, func(t *testing.T) {
+			migrations, err := Load(driver)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, m := range migrations {
+				if m.Version != i+1 {
+					t.Errorf("want version %d; got %d (%s)", i+1, m.Version, m.Name)
+				}
+			}
+		})
+	}
+
+	if _, err := Load("oracle"); err == nil {
+		t.Error("want error for an unknown driver")
+	}
+}
+
+func TestLoadSameVersions(t *testing.T) {
+	mysql, err := Load("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := Load("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(migrations []Migration) []string {
+		var names []string
+		for _, m := range migrations {
+			names = append(names, m.Name)
+		}
+		return names
+	}
+	if !reflect.DeepEqual(names(mysql), names(sqlite)) {
+		t.Errorf("want the same migrations for every driver; got %v and %v", names(mysql), names(sqlite))
+	}
+}
+
+func TestStatements(t *testing.T) {
+	content := "-- A comment;\nCREATE TABLE a (id int);\n\nCREATE INDEX b ON a (id);\n"
+	want := []string{"CREATE TABLE a (id int)", "CREATE INDEX b ON a (id)"}
+
+	got := statements(content)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %q; got %q", want, got)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m := &Migrator{DB: db, Driver: "sqlite"}
+	all, err := Load("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(all) {
+		t.Errorf("want %d migrations applied; got %d", len(all), len(done))
+	}
+
+	done, err = m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 0 {
+		t.Errorf("want no migrations applied a second time; got %d", len(done))
+	}
+
+	last, err := m.Down()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Version != all[len(all)-1].Version {
+		t.Errorf("want version %d reverted; got %d", all[len(all)-1].Version, last.Version)
+	}
+
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range status {
+		want := i < len(status)-1
+		if s.Applied != want {
+			t.Errorf("version %d: want applied %v; got %v", s.Version, want, s.Applied)
+		}
+		if s.Applied && s.AppliedAt.IsZero() {
+			t.Errorf("version %d: want the time it was applied", s.Version)
+		}
+	}
+
+	for range all[:len(all)-1] {
+		if _, err = m.Down(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = m.Down(); err != ErrNoApplied {
+		t.Errorf("want %v; got %v", ErrNoApplied, err)
+	}
+}
+
+// legacySchema is the schema of a database created before there were
+// migrations, from the snippetbox.sql dump, with a couple of snippets.
+const legacySchema = `
+CREATE TABLE users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL,
+  email TEXT NOT NULL,
+  hashed_password TEXT NOT NULL,
+  created DATETIME NOT NULL,
+  CONSTRAINT users_uc_email UNIQUE (email)
+);
+CREATE TABLE snippets (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  title TEXT NOT NULL,
+  content TEXT NOT NULL,
+  created DATETIME NOT NULL,
+  expires DATETIME NOT NULL
+);
+CREATE INDEX idx_snippets_created ON snippets (created);
+INSERT INTO snippets (id, title, content, created, expires) VALUES
+(1, 'An old silent pond', 'An old silent pond...', '2021-04-01 19:35:02', '2022-04-01 19:35:02'),
+(2, 'Over the wintry forest', 'Over the wintry forest...', '2021-04-01 19:35:02', '2022-04-01 19:35:02');
+`
+
+func TestMigratorLegacyDatabase(t *testing.T) {
+	tests := []struct {
+		name         string
+		users        string
+		wantOwner    string
+		wantDisabled bool
+	}{
+		{"With users", `INSERT INTO users (id, name, email, hashed_password, created) VALUES
+		(1, 'admin', 'admin@example.com', 'hash', '2021-04-06 21:42:03'),
+		(2, 'bob', 'bob@example.com', 'hash', '2021-04-07 21:42:03')`, "admin@example.com", false},
+		{"Without users", "", "legacy@snippetbox.invalid", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			for _, stmt := range append(statements(legacySchema), tt.users) {
+				if stmt == "" {
+					continue
+				}
+				if _, err = db.Exec(stmt); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			m := &Migrator{DB: db, Driver: "sqlite"}
+			if _, err = m.Up(); err != nil {
+				t.Fatal(err)
+			}
+
+			rows, err := db.Query(`SELECT s.id, s.title, s.language, s.visibility, u.email, u.disabled
+			FROM snippets AS s INNER JOIN users AS u ON u.id = s.user_id ORDER BY s.id`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			var ids []int
+			for rows.Next() {
+				var id int
+				var title, language, visibility, owner string
+				var disabled bool
+				if err = rows.Scan(&id, &title, &language, &visibility, &owner, &disabled); err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, id)
+				if language != "plaintext" || visibility != "public" {
+					t.Errorf("snippet %d: want plaintext and public; got %s and %s", id, language, visibility)
+				}
+				if owner != tt.wantOwner || disabled != tt.wantDisabled {
+					t.Errorf("snippet %d: want owner %s (disabled %v); got %s (disabled %v)", id, tt.wantOwner, tt.wantDisabled, owner, disabled)
+				}
+			}
+			if err = rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ids, []int{1, 2}) {
+				t.Errorf("want snippets [1 2] kept; got %v", ids)
+			}
+
+			_, err = db.Exec(`INSERT INTO snippets (user_id, title, content, language, visibility, slug, created, expires)
+			VALUES (1, 'New', 'Content', 'go', 'unlisted', 'abc', datetime('now'), datetime('now', '+1 day'))`)
+			if err != nil {
+				t.Errorf("want a snippet with every column inserted; got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,5 @@
+-- failed_logins counts the failed login attempts since the last successful
+-- one. Once it reaches the limit the account is locked until locked_until.
+ALTER TABLE `users`
+  ADD COLUMN `failed_logins` int NOT NULL DEFAULT 0,
+  ADD COLUMN `locked_until` datetime NULL;
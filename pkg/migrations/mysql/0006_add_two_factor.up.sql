@@ -0,0 +1,15 @@
+-- totp_secret is set while two-factor authentication is enabled.
+-- totp_last_step is the time step of the last code used, so that a code
+-- can't be used twice.
+ALTER TABLE `users`
+  ADD COLUMN `totp_secret` varchar(64) COLLATE utf8mb4_unicode_ci NULL,
+  ADD COLUMN `totp_last_step` bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `hash` char(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `recovery_codes_uc_user_id_hash` (`user_id`, `hash`),
+  CONSTRAINT `fk_recovery_codes_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
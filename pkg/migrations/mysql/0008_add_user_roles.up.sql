@@ -0,0 +1,4 @@
+-- role is one of 'user', 'moderator' or 'admin'. Disabled users can't log in.
+ALTER TABLE `users`
+  ADD COLUMN `role` varchar(16) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT 'user',
+  ADD COLUMN `disabled` tinyint(1) NOT NULL DEFAULT 0;
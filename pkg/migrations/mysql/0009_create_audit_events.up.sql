@@ -0,0 +1,15 @@
+-- audit_events records who did what. actor_id is NULL for events which
+-- weren't caused by a logged in user, and is kept as NULL if the actor's
+-- account is deleted.
+CREATE TABLE IF NOT EXISTS `audit_events` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `actor_id` int NULL,
+  `ip_address` varchar(45) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `user_agent` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `event` varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `target` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `created` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_audit_events_created` (`created`),
+  CONSTRAINT `fk_audit_events_actor_id` FOREIGN KEY (`actor_id`) REFERENCES `users` (`id`) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
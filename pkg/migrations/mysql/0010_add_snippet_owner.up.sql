@@ -0,0 +1,16 @@
+-- Snippets created before they had owners are given to the first user. If
+-- there are snippets but no users, they go to a placeholder account which is
+-- disabled and has no usable password.
+INSERT INTO `users` (`name`, `email`, `hashed_password`, `created`, `disabled`)
+SELECT 'Legacy snippets', 'legacy@snippetbox.invalid', '!', UTC_TIMESTAMP(), 1
+FROM DUAL
+WHERE EXISTS (SELECT 1 FROM `snippets`) AND NOT EXISTS (SELECT 1 FROM `users`);
+
+ALTER TABLE `snippets` ADD COLUMN `user_id` int NULL AFTER `id`;
+
+UPDATE `snippets` SET `user_id` = (SELECT MIN(`id`) FROM `users`);
+
+ALTER TABLE `snippets`
+  MODIFY `user_id` int NOT NULL,
+  ADD KEY `idx_snippets_user_id` (`user_id`),
+  ADD CONSTRAINT `fk_snippets_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`);
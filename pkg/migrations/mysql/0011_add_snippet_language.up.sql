@@ -0,0 +1,2 @@
+ALTER TABLE `snippets`
+  ADD COLUMN `language` varchar(20) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT 'plaintext' AFTER `content`;
@@ -0,0 +1,5 @@
+-- slug is the random identifier unlisted snippets are shared by.
+ALTER TABLE `snippets`
+  ADD COLUMN `visibility` enum('public','unlisted','private') COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT 'public' AFTER `language`,
+  ADD COLUMN `slug` char(22) COLLATE utf8mb4_unicode_ci DEFAULT NULL AFTER `visibility`,
+  ADD UNIQUE KEY `snippets_uc_slug` (`slug`);
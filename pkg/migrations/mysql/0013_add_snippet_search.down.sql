@@ -0,0 +1 @@
+ALTER TABLE `snippets` DROP KEY `ft_snippets_title_content`;
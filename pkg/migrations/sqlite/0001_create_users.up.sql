@@ -0,0 +1,11 @@
+-- The users and snippets tables start out as they were in the MySQL schema
+-- before there were migrations, and the later migrations bring them up to
+-- date, so that the versions match for every driver.
+CREATE TABLE IF NOT EXISTS users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL,
+  email TEXT NOT NULL COLLATE NOCASE,
+  hashed_password TEXT NOT NULL,
+  created DATETIME NOT NULL,
+  CONSTRAINT users_uc_email UNIQUE (email)
+);
@@ -0,0 +1,10 @@
+-- Dates are stored as UTC in the 'YYYY-MM-DD HH:MM:SS' format returned by
+-- datetime('now'), so that they can be compared as strings.
+CREATE TABLE IF NOT EXISTS snippets (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  title TEXT NOT NULL,
+  content TEXT NOT NULL,
+  created DATETIME NOT NULL,
+  expires DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_snippets_created ON snippets (created);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS tokens (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  hash TEXT NOT NULL,
+  created DATETIME NOT NULL,
+  CONSTRAINT tokens_uc_hash UNIQUE (hash)
+);
+CREATE INDEX IF NOT EXISTS idx_tokens_user_id ON tokens (user_id);
@@ -0,0 +1,4 @@
+-- failed_logins counts the failed login attempts since the last successful
+-- one. Once it reaches the limit the account is locked until locked_until.
+ALTER TABLE users ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN locked_until DATETIME;
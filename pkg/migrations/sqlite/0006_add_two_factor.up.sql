@@ -0,0 +1,12 @@
+-- totp_secret is set while two-factor authentication is enabled.
+-- totp_last_step is the time step of the last code used, so that a code
+-- can't be used twice.
+ALTER TABLE users ADD COLUMN totp_secret TEXT;
+ALTER TABLE users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  hash TEXT NOT NULL,
+  CONSTRAINT recovery_codes_uc_user_id_hash UNIQUE (user_id, hash)
+);
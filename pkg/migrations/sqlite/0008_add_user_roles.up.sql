@@ -0,0 +1,3 @@
+-- role is one of 'user', 'moderator' or 'admin'. Disabled users can't log in.
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD COLUMN disabled INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,13 @@
+-- audit_events records who did what. actor_id is NULL for events which
+-- weren't caused by a logged in user, and is kept as NULL if the actor's
+-- account is deleted.
+CREATE TABLE IF NOT EXISTS audit_events (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  actor_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+  ip_address TEXT NOT NULL,
+  user_agent TEXT NOT NULL,
+  event TEXT NOT NULL,
+  target TEXT NOT NULL,
+  created DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created ON audit_events (created);
@@ -0,0 +1,12 @@
+CREATE TABLE snippets_old (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  title TEXT NOT NULL,
+  content TEXT NOT NULL,
+  created DATETIME NOT NULL,
+  expires DATETIME NOT NULL
+);
+INSERT INTO snippets_old (id, title, content, created, expires)
+SELECT id, title, content, created, expires FROM snippets;
+DROP TABLE snippets;
+ALTER TABLE snippets_old RENAME TO snippets;
+CREATE INDEX idx_snippets_created ON snippets (created);
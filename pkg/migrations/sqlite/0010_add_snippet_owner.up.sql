@@ -0,0 +1,23 @@
+-- Snippets created before they had owners are given to the first user. If
+-- there are snippets but no users, they go to a placeholder account which is
+-- disabled and has no usable password.
+INSERT INTO users (name, email, hashed_password, created, disabled)
+SELECT 'Legacy snippets', 'legacy@snippetbox.invalid', '!', datetime('now'), 1
+WHERE EXISTS (SELECT 1 FROM snippets) AND NOT EXISTS (SELECT 1 FROM users);
+
+-- SQLite can't add a NOT NULL column with a foreign key to an existing
+-- table, so the table is rebuilt with it.
+CREATE TABLE snippets_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users (id),
+  title TEXT NOT NULL,
+  content TEXT NOT NULL,
+  created DATETIME NOT NULL,
+  expires DATETIME NOT NULL
+);
+INSERT INTO snippets_new (id, user_id, title, content, created, expires)
+SELECT id, (SELECT MIN(id) FROM users), title, content, created, expires FROM snippets;
+DROP TABLE snippets;
+ALTER TABLE snippets_new RENAME TO snippets;
+CREATE INDEX idx_snippets_created ON snippets (created);
+CREATE INDEX idx_snippets_user_id ON snippets (user_id);
@@ -0,0 +1,5 @@
+-- slug is the random identifier unlisted snippets are shared by. SQLite
+-- can't add a UNIQUE column, so its uniqueness comes from an index instead.
+ALTER TABLE snippets ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'unlisted', 'private'));
+ALTER TABLE snippets ADD COLUMN slug TEXT DEFAULT NULL;
+CREATE UNIQUE INDEX snippets_uc_slug ON snippets (slug);
@@ -0,0 +1,2 @@
+-- The SQLite models search with LIKE, which can't use an index, so unlike
+-- MySQL there is nothing to add.
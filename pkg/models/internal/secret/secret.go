@@ -0,0 +1,63 @@
+// Package secret generates and hashes the random secrets the models hand out:
+// API tokens, session and password reset tokens, and two-factor recovery
+// codes, and holds the dummy password hash used when logging in. It is shared
+// by the database backends, which must agree on the hashes so that a database
+// can be moved between them.
+package secret
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// DummyPasswordHash is a bcrypt hash, at the cost the models use, of a
+// password nobody knows. Logging in with an unknown email is checked against
+// it so that it takes as long as a wrong password, and the response time
+// doesn't give away which accounts exist.
+var DummyPasswordHash = []byte("$2a$12$XkDchvVV4gDmL9mIh7cf4.c1giqgkPJW9Ql6ADDIQyVu9nzyCzq9u")
+
+// RandomString returns a URL-safe string encoding n random bytes.
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Hash returns the hex encoded SHA-256 hash of a plaintext token. Tokens are
+// long random strings, so unlike passwords a fast hash is enough and lets us
+// look tokens up directly by their hash.
+func Hash(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// recoveryAlphabet is Crockford's base32 alphabet, which leaves out the
+// letters most easily confused with digits.
+const recoveryAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+// NewRecoveryCode returns a random recovery code such as "7kq2m-x9hfa".
+func NewRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = recoveryAlphabet[b[i]&31]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+// NormalizeRecoveryCode removes the formatting from a recovery code typed in
+// by a user, and replaces the letters which aren't in the alphabet with the
+// digits they are mistaken for, so that it can be hashed and compared.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "", "o", "0", "i", "1", "l", "1").Replace(code)
+}
@@ -0,0 +1,68 @@
+package secret
+
+import (
+	"regexp"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestDummyPasswordHash(t *testing.T) {
+	// The dummy hash is only useful if checking it costs the same as checking
+	// a real password hash.
+	cost, err := bcrypt.Cost(DummyPasswordHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost != 12 {
+		t.Errorf("want cost 12; got %d", cost)
+	}
+}
+
+func TestRandomString(t *testing.T) {
+	a, err := RandomString(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := RandomString(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 43 || a == b {
+		t.Errorf("want two different 43 character strings; got %q and %q", a, b)
+	}
+}
+
+func TestHash(t *testing.T) {
+	want := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if got := Hash("hello"); got != want {
+		t.Errorf("want %q; got %q", want, got)
+	}
+}
+
+func TestRecoveryCode(t *testing.T) {
+	code, err := NewRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^[0-9a-hjkmnp-tv-z]{5}-[0-9a-hjkmnp-tv-z]{5}$`).MatchString(code) {
+		t.Errorf("unexpected recovery code %q", code)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{"Formatted", "7kq2m-x9hfa", "7kq2mx9hfa"},
+		{"Upper case with spaces", "7KQ2M X9HFA", "7kq2mx9hfa"},
+		{"Confusable letters", "o1il0-x9hfa", "01110x9hfa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeRecoveryCode(tt.code); got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package mock
+
+import (
+	"context"
+	"sync"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+)
+
+// AuditModel keeps the events in memory, so that tests can check what was
+// recorded. The zero value is ready to use.
+type AuditModel struct {
+	mu     sync.Mutex
+	events []*models.AuditEvent
+}
+
+func (m *AuditModel) Insert(ctx context.Context, actorID int, ipAddress, userAgent, event, target string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, &models.AuditEvent{
+		ID:        len(m.events) + 1,
+		ActorID:   actorID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Event:     event,
+		Target:    target,
+		Created:   time.Now(),
+	})
+	return nil
+}
+
+// Events returns the events recorded so far, oldest first.
+func (m *AuditModel) Events() []*models.AuditEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*models.AuditEvent(nil), m.events...)
+}
+
+func (m *AuditModel) List(ctx context.Context, since, until time.Time, page, pageSize int) ([]*models.AuditEvent, int, error) {
+	events := []*models.AuditEvent{}
+	m.Export(ctx, since, until, func(e *models.AuditEvent) error {
+		events = append([]*models.AuditEvent{e}, events...)
+		return nil
+	})
+	return events, len(events), nil
+}
+
+func (m *AuditModel) Export(ctx context.Context, since, until time.Time, fn func(*models.AuditEvent) error) error {
+	for _, e := range m.Events() {
+		if (!since.IsZero() && e.Created.Before(since)) || (!until.IsZero() && !e.Created.Before(until)) {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package mock
+
+import (
+	"context"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+)
+
+type ResetTokenModel struct{}
+
+func (m *ResetTokenModel) Insert(ctx context.Context, userID int, ttl time.Duration) (string, error) {
+	return "valid-reset-token", nil
+}
+
+func (m *ResetTokenModel) ResetPassword(ctx context.Context, plaintext, password string) (int, error) {
+	switch plaintext {
+	case "valid-reset-token":
+		return 1, nil
+	default:
+		return 0, models.ErrNoRecord
+	}
+}
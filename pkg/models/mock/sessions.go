@@ -0,0 +1,126 @@
+package mock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+)
+
+// SessionModel is a working session store which keeps the sessions in
+// memory, so that tests can log in, list and revoke sessions without a
+// database. The zero value is ready to use.
+type SessionModel struct {
+	mu       sync.Mutex
+	nextID   int
+	sessions map[string]*models.Session
+}
+
+func (m *SessionModel) Insert(ctx context.Context, userID int, ipAddress, userAgent string, ttl time.Duration) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions == nil {
+		m.sessions = make(map[string]*models.Session)
+	}
+	m.nextID++
+	now := time.Now()
+	m.sessions[token] = &models.Session{
+		ID:        m.nextID,
+		UserID:    userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Created:   now,
+		LastSeen:  now,
+		Expires:   now.Add(ttl),
+	}
+	return token, nil
+}
+
+func (m *SessionModel) Get(ctx context.Context, token string) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[token]
+	if !ok || !s.Expires.After(time.Now()) {
+		return nil, models.ErrNoRecord
+	}
+	c := *s
+	return &c, nil
+}
+
+func (m *SessionModel) Touch(ctx context.Context, ID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.sessions {
+		if s.ID == ID {
+			s.LastSeen = time.Now()
+		}
+	}
+	return nil
+}
+
+func (m *SessionModel) List(ctx context.Context, userID int) ([]*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessions := []*models.Session{}
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.Expires.After(time.Now()) {
+			c := *s
+			sessions = append(sessions, &c)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID > sessions[j].ID })
+	return sessions, nil
+}
+
+func (m *SessionModel) Delete(ctx context.Context, userID, ID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for token, s := range m.sessions {
+		if s.ID == ID && s.UserID == userID {
+			delete(m.sessions, token)
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+func (m *SessionModel) DeleteAll(ctx context.Context, userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for token, s := range m.sessions {
+		if s.UserID == userID {
+			delete(m.sessions, token)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *SessionModel) DeleteExpired(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for token, s := range m.sessions {
+		if !s.Expires.After(time.Now()) {
+			delete(m.sessions, token)
+			n++
+		}
+	}
+	return n, nil
+}
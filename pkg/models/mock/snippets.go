@@ -1,33 +1,148 @@
 package mock
 
 import (
+	"context"
 	"time"
 	"wilbertopachecob/snippetbox/pkg/models"
 )
 
 var mockSnippet = &models.Snippet{
-	ID:      1,
-	Title:   "An old silent pond",
-	Content: "An old silent pond...",
-	Created: time.Now(),
-	Expires: time.Now(),
+	ID:         1,
+	UserID:     1,
+	Author:     "Admin",
+	Title:      "An old silent pond",
+	Content:    "An old silent pond...",
+	Language:   "plaintext",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now(),
+}
+
+var mockOtherSnippet = &models.Snippet{
+	ID:         3,
+	UserID:     2,
+	Author:     "Bob",
+	Title:      "Over the wintry forest",
+	Content:    "Over the wintry forest...",
+	Language:   "plaintext",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now(),
+}
+
+// mockScriptSnippet contains markup, to check that templates escape what
+// users store in their snippets.
+var mockScriptSnippet = &models.Snippet{
+	ID:         4,
+	UserID:     2,
+	Author:     "<script>alert('author')</script>",
+	Title:      "<script>alert('title')</script>",
+	Content:    "<script>alert('content')</script>",
+	Language:   "plaintext",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now(),
+}
+
+var mockUnlistedSnippet = &models.Snippet{
+	ID:         5,
+	UserID:     2,
+	Author:     "Bob",
+	Title:      "First autumn morning",
+	Content:    "First autumn morning...",
+	Language:   "plaintext",
+	Visibility: models.VisibilityUnlisted,
+	Slug:       "unlisted-slug",
+	Created:    time.Now(),
+	Expires:    time.Now(),
+}
+
+var mockPrivateSnippet = &models.Snippet{
+	ID:         6,
+	UserID:     1,
+	Author:     "Admin",
+	Title:      "O snail",
+	Content:    "O snail...",
+	Language:   "plaintext",
+	Visibility: models.VisibilityPrivate,
+	Created:    time.Now(),
+	Expires:    time.Now(),
 }
 
 type SnippetModel struct{}
 
-func (m *SnippetModel) Insert(title, content, expires string) (int, error) {
+func (m *SnippetModel) Insert(ctx context.Context, userID int, title, content, language, visibility, expires string) (int, error) {
+	switch userID {
+	case 1:
+		return 2, nil
+	default:
+		return 0, models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) DeleteExpired(ctx context.Context) (int, error) {
 	return 2, nil
 }
 
-func (m *SnippetModel) Get(ID int) (*models.Snippet, error) {
+func (m *SnippetModel) Get(ctx context.Context, ID int) (*models.Snippet, error) {
 	switch ID {
 	case 1:
 		return mockSnippet, nil
+	case 3:
+		return mockOtherSnippet, nil
+	case 4:
+		return mockScriptSnippet, nil
+	case 5:
+		return mockUnlistedSnippet, nil
+	case 6:
+		return mockPrivateSnippet, nil
+	case 7:
+		// Stands in for a query that ran out of time.
+		return nil, context.DeadlineExceeded
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) GetBySlug(ctx context.Context, slug string) (*models.Snippet, error) {
+	switch slug {
+	case "unlisted-slug":
+		return mockUnlistedSnippet, nil
 	default:
 		return nil, models.ErrNoRecord
 	}
 }
 
-func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
-	return []*models.Snippet{mockSnippet}, nil
+func (m *SnippetModel) List(ctx context.Context, page, pageSize int) ([]*models.Snippet, int, error) {
+	switch page {
+	case 1:
+		return []*models.Snippet{mockSnippet}, 1, nil
+	default:
+		return []*models.Snippet{}, 1, nil
+	}
+}
+
+func (m *SnippetModel) Update(ctx context.Context, ID int, title, content, language, visibility, expires string) error {
+	switch ID {
+	case 1, 3:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) Delete(ctx context.Context, ID int) error {
+	switch ID {
+	case 1, 3:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) Search(ctx context.Context, q string, page, pageSize int) ([]*models.Snippet, int, error) {
+	if q == "pond" && page == 1 {
+		return []*models.Snippet{mockSnippet}, 1, nil
+	}
+	return []*models.Snippet{}, 0, nil
 }
@@ -0,0 +1,45 @@
+package mock
+
+import (
+	"context"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+)
+
+var mockToken = &models.Token{
+	ID:      1,
+	UserID:  1,
+	Name:    "CI scripts",
+	Created: time.Now(),
+}
+
+type TokenModel struct{}
+
+func (m *TokenModel) Insert(ctx context.Context, userID int, name string) (string, error) {
+	return "new-plaintext-token", nil
+}
+
+func (m *TokenModel) List(ctx context.Context, userID int) ([]*models.Token, error) {
+	switch userID {
+	case 1:
+		return []*models.Token{mockToken}, nil
+	default:
+		return []*models.Token{}, nil
+	}
+}
+
+func (m *TokenModel) Delete(ctx context.Context, userID, ID int) error {
+	if userID == mockToken.UserID && ID == mockToken.ID {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+func (m *TokenModel) Authenticate(ctx context.Context, plaintext string) (int, error) {
+	switch plaintext {
+	case "valid-token":
+		return 1, nil
+	default:
+		return 0, models.ErrNoRecord
+	}
+}
@@ -0,0 +1,56 @@
+package mock
+
+import (
+	"context"
+	"wilbertopachecob/snippetbox/pkg/models"
+)
+
+// The mock user 1 doesn't use two-factor authentication. User 2 does, and
+// accepts mockTOTPCode and mockRecoveryCode.
+const (
+	mockTOTPSecret   = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	mockTOTPCode     = "123456"
+	mockRecoveryCode = "abcde-fghjk"
+)
+
+type TwoFactorModel struct{}
+
+func (m *TwoFactorModel) Secret(ctx context.Context, userID int) (string, error) {
+	switch userID {
+	case 1, 3:
+		return "", nil
+	case 2:
+		return mockTOTPSecret, nil
+	default:
+		return "", models.ErrNoRecord
+	}
+}
+
+func (m *TwoFactorModel) Enable(ctx context.Context, userID int, secret string) ([]string, error) {
+	return []string{mockRecoveryCode}, nil
+}
+
+func (m *TwoFactorModel) Disable(ctx context.Context, userID int) error {
+	return nil
+}
+
+func (m *TwoFactorModel) Verify(ctx context.Context, userID int, code string) error {
+	if userID == 2 && code == mockTOTPCode {
+		return nil
+	}
+	return models.ErrInvalidCredentials
+}
+
+func (m *TwoFactorModel) UseRecoveryCode(ctx context.Context, userID int, code string) error {
+	if userID == 2 && code == mockRecoveryCode {
+		return nil
+	}
+	return models.ErrInvalidCredentials
+}
+
+func (m *TwoFactorModel) RecoveryCodesLeft(ctx context.Context, userID int) (int, error) {
+	if userID == 2 {
+		return 1, nil
+	}
+	return 0, nil
+}
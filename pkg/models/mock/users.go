@@ -1,6 +1,8 @@
 package mock
 
 import (
+	"context"
+	"strings"
 	"time"
 	"wilbertopachecob/snippetbox/pkg/models"
 )
@@ -12,31 +14,125 @@ var mockUser = &models.User{
 	Name:    "Admin",
 	Email:   "admin@gmail.com",
 	Created: time.Now(),
+	Role:    models.RoleAdmin,
 }
 
-func (m *UserModel) Insert(name, email, password string) error {
+// mockTwoFactorUser has two-factor authentication enabled in the mock
+// TwoFactorModel.
+var mockTwoFactorUser = &models.User{
+	ID:      2,
+	Name:    "Carol",
+	Email:   "twofactor@example.com",
+	Created: time.Now(),
+	Role:    models.RoleUser,
+}
+
+var mockModerator = &models.User{
+	ID:      3,
+	Name:    "Dave",
+	Email:   "moderator@example.com",
+	Created: time.Now(),
+	Role:    models.RoleModerator,
+}
+
+var mockUsers = []*models.User{mockUser, mockTwoFactorUser, mockModerator}
+
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (int, error) {
 	switch email {
 	case "admin@gmail.com":
-		return nil
+		return 4, nil
 	default:
-		return models.ErrDuplicateEmail
+		return 0, models.ErrDuplicateEmail
 	}
 }
 
-func (m *UserModel) Authenticate(email, password string) (int, error) {
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
 	switch email {
 	case "admin@gmail.com":
 		return 1, nil
+	case "twofactor@example.com":
+		return 2, nil
+	case "moderator@example.com":
+		return 3, nil
+	case "locked@example.com":
+		return 0, models.ErrAccountLocked
+	case "disabled@example.com":
+		return 0, models.ErrAccountDisabled
+	case "nobody@example.com":
+		return 0, models.ErrNoRecord
 	default:
 		return 0, models.ErrInvalidCredentials
 	}
 }
 
-func (m *UserModel) Get(ID int) (*models.User, error) {
+func (m *UserModel) Get(ctx context.Context, ID int) (*models.User, error) {
 	switch ID {
 	case 1:
 		return mockUser, nil
+	case 2:
+		return mockTwoFactorUser, nil
+	case 3:
+		return mockModerator, nil
 	default:
 		return nil, models.ErrNoRecord
 	}
 }
+
+func (m *UserModel) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	switch email {
+	case "admin@gmail.com":
+		return mockUser, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) UpdatePassword(ctx context.Context, ID int, password string) error {
+	switch ID {
+	case 1:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) UpdateProfile(ctx context.Context, ID int, name, email string) error {
+	switch email {
+	case "dupe@example.com":
+		return models.ErrDuplicateEmail
+	default:
+		return nil
+	}
+}
+
+func (m *UserModel) ChangePassword(ctx context.Context, ID int, currentPassword, newPassword string) error {
+	switch currentPassword {
+	case "validPa$$word":
+		return nil
+	default:
+		return models.ErrInvalidCredentials
+	}
+}
+
+func (m *UserModel) List(ctx context.Context, q string, page, pageSize int) ([]*models.User, int, error) {
+	users := []*models.User{}
+	for _, u := range mockUsers {
+		if strings.Contains(u.Name, q) || strings.Contains(u.Email, q) {
+			users = append(users, u)
+		}
+	}
+	return users, len(users), nil
+}
+
+func (m *UserModel) SetRole(ctx context.Context, ID int, role string) error {
+	return m.exists(ID)
+}
+
+func (m *UserModel) SetDisabled(ctx context.Context, ID int, disabled bool) error {
+	return m.exists(ID)
+}
+
+func (m *UserModel) exists(ID int) error {
+	_, err := m.Get(context.Background(), ID)
+	return err
+}
@@ -13,20 +13,114 @@ var (
 	// Add a new ErrDuplicateEmail error. We'll use this later if a user
 	// tries to signup with an email address that's already in use.
 	ErrDuplicateEmail = errors.New("models: duplicate email")
+	// ErrAccountLocked is returned when logging in to an account which is
+	// temporarily locked after too many failed attempts.
+	ErrAccountLocked = errors.New("models: account temporarily locked")
+	// ErrAccountDisabled is returned when logging in to an account which an
+	// admin has disabled.
+	ErrAccountDisabled = errors.New("models: account disabled")
+)
+
+// The visibility of a snippet decides who can see it. Public snippets are
+// listed on the home page. Unlisted snippets aren't listed and can only be
+// reached through their random Slug. Private snippets are only visible to
+// their author.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
 )
 
 type Snippet struct {
 	ID      int
+	UserID  int
+	Author  string
 	Title   string
 	Content string
+	// Language is the name of the programming language the content is
+	// written in, used for syntax highlighting.
+	Language   string
+	Visibility string
+	// Slug is the random identifier used in the URL of unlisted snippets.
+	// It is empty for snippets that have never been unlisted.
+	Slug    string
 	Created time.Time
 	Expires time.Time
 }
 
+// The role of a user decides what they are allowed to do. Each role can do
+// everything the roles before it can: moderators can also delete any
+// snippet, and admins can also manage users.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles lists the roles from the least to the most privileged.
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
 type User struct {
 	ID       int
 	Email    string
 	Name     string
 	Created  time.Time
 	Password string
+	Role     string
+	Disabled bool
+}
+
+// HasRole reports whether the user has the given role, or a more privileged
+// one.
+func (u *User) HasRole(role string) bool {
+	want := roleRank(role)
+	return want >= 0 && roleRank(u.Role) >= want
+}
+
+// roleRank returns the position of role in Roles, or -1 for unknown roles.
+func roleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// Token is a personal API token. Only a hash of the token is stored, so the
+// plaintext value is never available after it has been created.
+type Token struct {
+	ID      int
+	UserID  int
+	Name    string
+	Created time.Time
+}
+
+// Session is a login session kept on the server, so that it can be listed
+// and revoked. The session cookie holds a random token, of which only a hash
+// is stored.
+type Session struct {
+	ID        int
+	UserID    int
+	IPAddress string
+	UserAgent string
+	Created   time.Time
+	LastSeen  time.Time
+	Expires   time.Time
+}
+
+// AuditEvent records a security-relevant action. ActorID is the user who
+// performed it, or zero if nobody was logged in. Target names what the
+// action was performed on, such as "user:2" or "snippet:5".
+type AuditEvent struct {
+	ID      int
+	ActorID int
+	// ActorEmail is filled in when listing events, and is empty if the
+	// actor's account has been deleted.
+	ActorEmail string
+	IPAddress  string
+	UserAgent  string
+	Event      string
+	Target     string
+	Created    time.Time
 }
@@ -0,0 +1,124 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+)
+
+// auditTimeFormat is how times are passed to the audit queries. Both
+// databases compare it correctly with the created column.
+const auditTimeFormat = "2006-01-02 15:04:05"
+
+// maxAuditTarget is the length of the target column. Longer targets, such as
+// the email address typed into a failed login, are truncated.
+const maxAuditTarget = 255
+
+// AuditModel records security-relevant events.
+type AuditModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Insert records an event performed by the user actorID, or by nobody in
+// particular if actorID is zero, from the given IP address and user agent.
+func (m *AuditModel) Insert(ctx context.Context, actorID int, ipAddress, userAgent, event, target string) error {
+	if len(userAgent) > maxUserAgent {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgent], "")
+	}
+	if len(target) > maxAuditTarget {
+		target = strings.ToValidUTF8(target[:maxAuditTarget], "")
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `INSERT INTO audit_events (actor_id, ip_address, user_agent, event, target, created)
+	VALUES (NULLIF(?, 0), ?, ?, ?, ?, UTC_TIMESTAMP())`
+	_, err := m.DB.ExecContext(ctx, query, actorID, ipAddress, userAgent, event, target)
+	return err
+}
+
+// auditWhere limits the audit queries to the events created at or after since
+// and before until. A zero time leaves that end of the range open.
+func auditWhere(since, until time.Time) (string, []interface{}) {
+	where := `WHERE (? OR a.created >= ?) AND (? OR a.created < ?)`
+	args := []interface{}{
+		since.IsZero(), since.UTC().Format(auditTimeFormat),
+		until.IsZero(), until.UTC().Format(auditTimeFormat),
+	}
+	return where, args
+}
+
+// auditSelect selects the columns scanned by scanAuditEvent. The email
+// address of the actor is empty if there isn't one, or they have since been
+// deleted.
+const auditSelect = `SELECT a.id, COALESCE(a.actor_id, 0), COALESCE(u.email, ''), a.ip_address,
+	a.user_agent, a.event, a.target, a.created
+	FROM audit_events a LEFT JOIN users u ON u.id = a.actor_id `
+
+func scanAuditEvent(rows *sql.Rows) (*models.AuditEvent, error) {
+	e := &models.AuditEvent{}
+	err := rows.Scan(&e.ID, &e.ActorID, &e.ActorEmail, &e.IPAddress, &e.UserAgent, &e.Event, &e.Target, &e.Created)
+	return e, err
+}
+
+// List returns a page of the events created between since and until, newest
+// first, along with the total number of events in the range.
+func (m *AuditModel) List(ctx context.Context, since, until time.Time, page, pageSize int) ([]*models.AuditEvent, int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	where, args := auditWhere(since, until)
+	var total int
+	err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_events a `+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := auditSelect + where + ` ORDER BY a.id DESC LIMIT ? OFFSET ?`
+	rows, err := m.DB.QueryContext(ctx, query, append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []*models.AuditEvent{}
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// Export calls fn with every event created between since and until, oldest
+// first, and stops at the first error fn returns. The events are streamed
+// rather than loaded into memory, and the export isn't limited by Timeout,
+// since it can be arbitrarily long.
+func (m *AuditModel) Export(ctx context.Context, since, until time.Time, fn func(*models.AuditEvent) error) error {
+	where, args := auditWhere(since, until)
+	rows, err := m.DB.QueryContext(ctx, auditSelect+where+` ORDER BY a.id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err = fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,94 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+)
+
+func TestAuditModelInsert(t *testing.T) {
+	db := newTestDB(t)
+	m := &AuditModel{DB: db}
+	ctx := context.Background()
+
+	if err := m.Insert(ctx, 1, "192.0.2.1", "Mozilla/5.0", "admin.user.disable", "user:2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Insert(ctx, 0, "", "cli", "admin.user.role", "user:1 role:admin"); err != nil {
+		t.Fatal(err)
+	}
+	// Without truncation these would be too long for their columns.
+	if err := m.Insert(ctx, 0, "", strings.Repeat("a", 300), "user.login.failure", "email:"+strings.Repeat("a", 300)); err != nil {
+		t.Fatal(err)
+	}
+
+	var withActor, withoutActor, longestAgent, longestTarget int
+	err := db.QueryRow(`SELECT COUNT(actor_id), COUNT(*) - COUNT(actor_id), MAX(LENGTH(user_agent)), MAX(LENGTH(target))
+	FROM audit_events`).Scan(&withActor, &withoutActor, &longestAgent, &longestTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withActor != 1 || withoutActor != 2 {
+		t.Errorf("want one event with an actor and two without; got %d and %d", withActor, withoutActor)
+	}
+	if longestAgent != maxUserAgent || longestTarget != maxAuditTarget {
+		t.Errorf("want the user agent and target truncated to %d and %d; got %d and %d",
+			maxUserAgent, maxAuditTarget, longestAgent, longestTarget)
+	}
+}
+
+func TestAuditModelList(t *testing.T) {
+	db := newTestDB(t)
+	m := &AuditModel{DB: db}
+	ctx := context.Background()
+
+	_, err := db.Exec(`INSERT INTO audit_events (actor_id, ip_address, user_agent, event, target, created) VALUES
+	(1, '192.0.2.1', 'Mozilla/5.0', 'user.login', 'user:1', '2021-04-01 10:00:00'),
+	(NULL, '192.0.2.2', 'curl/7.0', 'user.login.failure', 'email:bob@example.com', '2021-04-02 10:00:00')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		since   time.Time
+		until   time.Time
+		wantIDs []int
+	}{
+		{"Everything", time.Time{}, time.Time{}, []int{2, 1}},
+		{"Since", day.AddDate(0, 0, 1), time.Time{}, []int{2}},
+		{"Until", time.Time{}, day.AddDate(0, 0, 1), []int{1}},
+		{"Empty range", day.AddDate(0, 0, 2), time.Time{}, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, total, err := m.List(ctx, tt.since, tt.until, 1, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []int{}
+			for _, e := range events {
+				ids = append(ids, e.ID)
+			}
+			if total != len(tt.wantIDs) || fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("want events %v; got %v of %d", tt.wantIDs, ids, total)
+			}
+		})
+	}
+
+	var exported []*models.AuditEvent
+	err = m.Export(ctx, time.Time{}, time.Time{}, func(e *models.AuditEvent) error {
+		exported = append(exported, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 2 || exported[0].ActorEmail != "alice@example.com" || exported[1].ActorID != 0 {
+		t.Errorf("want both events exported oldest first; got %d", len(exported))
+	}
+}
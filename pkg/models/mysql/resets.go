@@ -0,0 +1,82 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+	"wilbertopachecob/snippetbox/pkg/models/internal/secret"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type ResetTokenModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Insert creates a new password reset token for the given user, valid for
+// ttl, and returns its plaintext value. Like API tokens, only a hash of the
+// token is stored.
+func (m *ResetTokenModel) Insert(ctx context.Context, userID int, ttl time.Duration) (string, error) {
+	plaintext, err := secret.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `INSERT INTO password_resets (user_id, hash, expires)
+	VALUES (?, ?, DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? SECOND))`
+	_, err = m.DB.ExecContext(ctx, query, userID, secret.Hash(plaintext), int(ttl.Seconds()))
+	if err != nil {
+		return "", err
+	}
+	return plaintext, nil
+}
+
+// ResetPassword checks a plaintext reset token, replaces the password of the
+// user it was issued for with a bcrypt hash of the new one and returns the
+// user's id. The token is deleted in the same transaction, so it can only be
+// used once but isn't lost if the password can't be changed. If the token
+// doesn't exist or has expired we return models.ErrNoRecord.
+func (m *ResetTokenModel) ResetPassword(ctx context.Context, plaintext, password string) (int, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	query := `SELECT user_id FROM password_resets WHERE hash = ? AND expires > UTC_TIMESTAMP() FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, secret.Hash(plaintext)).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, models.ErrNoRecord
+		}
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET hashed_password = ? WHERE id = ?`, hashedPassword, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Once the password has been reset any other outstanding tokens for the
+	// user are pointless, so we remove all of them rather than just this one.
+	_, err = tx.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
@@ -0,0 +1,38 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+)
+
+func TestResetTokenModel(t *testing.T) {
+	db := newTestDB(t)
+	m := &ResetTokenModel{DB: db}
+	users := &UserModel{DB: db}
+	ctx := context.Background()
+
+	if _, err := m.ResetPassword(ctx, "unknown", "newPa55word"); err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+
+	token, err := m.Insert(ctx, 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := m.ResetPassword(ctx, token, "newPa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Errorf("want user 1; got %d", id)
+	}
+	if _, err = users.Authenticate(ctx, "alice@example.com", "newPa55word"); err != nil {
+		t.Errorf("want the new password to work; got %v", err)
+	}
+
+	if _, err = m.ResetPassword(ctx, token, "otherPa55word"); err != models.ErrNoRecord {
+		t.Errorf("want a used token to give %v; got %v", models.ErrNoRecord, err)
+	}
+}
@@ -0,0 +1,66 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+)
+
+func TestSessionModel(t *testing.T) {
+	db := newTestDB(t)
+	m := &SessionModel{DB: db}
+	ctx := context.Background()
+
+	alice, err := m.Insert(ctx, 1, "192.0.2.1", "Firefox", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := m.Insert(ctx, 1, "192.0.2.2", "Chrome", -time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := m.Insert(ctx, 2, "192.0.2.3", "Safari", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantUserID int
+		wantError  error
+	}{
+		{"Valid", alice, 1, nil},
+		{"Other user", bob, 2, nil},
+		{"Expired", expired, 0, models.ErrNoRecord},
+		{"Unknown", "no-such-token", 0, models.ErrNoRecord},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := m.Get(ctx, tt.token)
+			if err != tt.wantError {
+				t.Fatalf("want %v; got %v", tt.wantError, err)
+			}
+			if err == nil && s.UserID != tt.wantUserID {
+				t.Errorf("want user %d; got %d", tt.wantUserID, s.UserID)
+			}
+		})
+	}
+
+	sessions, err := m.List(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].UserAgent != "Firefox" {
+		t.Errorf("want only the unexpired session listed; got %+v", sessions)
+	}
+
+	if n, err := m.DeleteAll(ctx, 1); err != nil || n != 2 {
+		t.Errorf("want 2 sessions deleted; got %d, %v", n, err)
+	}
+	if _, err = m.Get(ctx, bob); err != nil {
+		t.Errorf("want the other user's session kept; got %v", err)
+	}
+}
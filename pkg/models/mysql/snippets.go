@@ -1,22 +1,56 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
+	"time"
 	"wilbertopachecob/snippetbox/pkg/models"
+	"wilbertopachecob/snippetbox/pkg/models/internal/secret"
 )
 
 type SnippetModel struct {
 	DB *sql.DB
+	// Timeout bounds how long each method may spend on the database, on top
+	// of any deadline the context passed to it already has. Zero means no
+	// extra limit.
+	Timeout time.Duration
 }
 
-// This will insert a new snippet into the database.
-func (m *SnippetModel) Insert(title, content, expires string) (int, error) {
-	query := `INSERT INTO snippets (title, content, created, expires) 
-	VALUES (?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+// withTimeout returns a copy of ctx which is cancelled after timeout, if
+// timeout is positive.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// newSlug returns a new slug for a snippet that is being made unlisted, or
+// nil if the snippet has another visibility.
+func newSlug(visibility string) (interface{}, error) {
+	if visibility != models.VisibilityUnlisted {
+		return nil, nil
+	}
+	return secret.RandomString(16)
+}
+
+// This will insert a new snippet into the database, owned by the user with
+// the given id. Unlisted snippets are given a random slug.
+func (m *SnippetModel) Insert(ctx context.Context, userID int, title, content, language, visibility, expires string) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	slug, err := newSlug(visibility)
+	if err != nil {
+		return 0, err
+	}
 
-	result, err := m.DB.Exec(query, title, content, expires)
+	query := `INSERT INTO snippets (user_id, title, content, language, visibility, slug, created, expires) 
+	VALUES (?, ?, ?, ?, ?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+
+	result, err := m.DB.ExecContext(ctx, query, userID, title, content, language, visibility, slug, expires)
 	if err != nil {
-		return 0, nil
+		return 0, err
 	}
 
 	ID, err := result.LastInsertId()
@@ -26,12 +60,82 @@ func (m *SnippetModel) Insert(title, content, expires string) (int, error) {
 	return int(ID), nil
 }
 
+// This will update the title, content, language, visibility and expiry of an
+// existing snippet. The new expiry is calculated from the current time, in the
+// same way as Insert, and an empty expires keeps the current one. A snippet
+// that becomes unlisted keeps its existing slug if it has one, so links that
+// were already shared keep working.
+func (m *SnippetModel) Update(ctx context.Context, ID int, title, content, language, visibility, expires string) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	slug, err := newSlug(visibility)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE snippets SET title = ?, content = ?, language = ?, visibility = ?,
+	slug = COALESCE(slug, ?), expires = CASE WHEN ? = '' THEN expires ELSE DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY) END
+	WHERE id = ?`
+
+	_, err = m.DB.ExecContext(ctx, query, title, content, language, visibility, slug, expires, expires, ID)
+	return err
+}
+
+// This will delete a specific snippet based on its id. If there is no
+// snippet with the given id we return models.ErrNoRecord.
+func (m *SnippetModel) Delete(ctx context.Context, ID int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `DELETE FROM snippets WHERE id = ?`
+
+	result, err := m.DB.ExecContext(ctx, query, ID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// This will permanently remove every expired snippet and return how many
+// were deleted.
+func (m *SnippetModel) DeleteExpired(ctx context.Context) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `DELETE FROM snippets WHERE expires <= UTC_TIMESTAMP()`
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
 // This will return a specific snippet based on its id.
-func (m *SnippetModel) Get(ID int) (*models.Snippet, error) {
-	query := `SELECT id, title, content, created, expires FROM snippets 
-	WHERE expires > UTC_TIMESTAMP() AND id = ?`
+func (m *SnippetModel) Get(ctx context.Context, ID int) (*models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `SELECT s.id, s.user_id, u.name, s.title, s.content, s.language, s.visibility,
+	COALESCE(s.slug, ''), s.created, s.expires
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id
+	WHERE s.expires > UTC_TIMESTAMP() AND s.id = ?`
 
-	row := m.DB.QueryRow(query, ID)
+	row := m.DB.QueryRowContext(ctx, query, ID)
 	s := &models.Snippet{}
 
 	// Use row.Scan() to copy the values from each field in sql.Row to the
@@ -41,7 +145,27 @@ func (m *SnippetModel) Get(ID int) (*models.Snippet, error) {
 	// columns returned by your statement. If the query returns no rows, then
 	// row.Scan() will return a sql.ErrNoRows error. We check for that and retu
 	// our own models.ErrNoRecord error instead of a Snippet object.
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := row.Scan(&s.ID, &s.UserID, &s.Author, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.Slug, &s.Created, &s.Expires)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNoRecord
+	} else if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// This will return a specific snippet based on its slug.
+func (m *SnippetModel) GetBySlug(ctx context.Context, slug string) (*models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `SELECT s.id, s.user_id, u.name, s.title, s.content, s.language, s.visibility,
+	COALESCE(s.slug, ''), s.created, s.expires
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id
+	WHERE s.expires > UTC_TIMESTAMP() AND s.slug = ?`
+
+	s := &models.Snippet{}
+	err := m.DB.QueryRowContext(ctx, query, slug).Scan(&s.ID, &s.UserID, &s.Author, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.Slug, &s.Created, &s.Expires)
 	if err == sql.ErrNoRows {
 		return nil, models.ErrNoRecord
 	} else if err != nil {
@@ -50,14 +174,31 @@ func (m *SnippetModel) Get(ID int) (*models.Snippet, error) {
 	return s, nil
 }
 
-// This will return the 10 most recently created snippets.
-func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
-	query := `SELECT id, title, content, created, expires FROM snippets 
-	WHERE expires > UTC_TIMESTAMP() ORDER BY created DESC LIMIT 10`
+// This will return one page of public snippets, most recently created first,
+// along with the total number of unexpired public snippets. Pages are
+// numbered from 1.
+func (m *SnippetModel) List(ctx context.Context, page, pageSize int) ([]*models.Snippet, int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var total int
+	err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND visibility = 'public'`).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The id is used as a tie-breaker so that snippets created in the same
+	// second have a stable order across pages.
+	query := `SELECT s.id, s.user_id, u.name, s.title, s.content, s.language, s.visibility,
+	COALESCE(s.slug, ''), s.created, s.expires
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id
+	WHERE s.expires > UTC_TIMESTAMP() AND s.visibility = 'public'
+	ORDER BY s.created DESC, s.id DESC LIMIT ? OFFSET ?`
 	snippets := []*models.Snippet{}
-	rows, err := m.DB.Query(query)
+	rows, err := m.DB.QueryContext(ctx, query, pageSize, (page-1)*pageSize)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	defer rows.Close()
@@ -74,9 +215,9 @@ func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
 		// must be pointers to the place you want to copy the data into, and the
 		// number of arguments must be exactly the same as the number of
 		// columns returned by your statement.
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err = rows.Scan(&s.ID, &s.UserID, &s.Author, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.Slug, &s.Created, &s.Expires)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		// Append it to the slice of snippets.
 		snippets = append(snippets, s)
@@ -87,8 +228,52 @@ func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
 	// call this - don't assume that a successful iteration was completed
 	// over the whole resultset.
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	return snippets, total, nil
+}
+
+// This will return one page of the unexpired public snippets matching a
+// full-text search on their title and content, most relevant first, along
+// with the total number of matches.
+func (m *SnippetModel) Search(ctx context.Context, q string, page, pageSize int) ([]*models.Snippet, int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var total int
+	err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND visibility = 'public'
+	AND MATCH (title, content) AGAINST (? IN NATURAL LANGUAGE MODE)`, q).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT s.id, s.user_id, u.name, s.title, s.content, s.language, s.visibility,
+	COALESCE(s.slug, ''), s.created, s.expires
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id
+	WHERE s.expires > UTC_TIMESTAMP() AND s.visibility = 'public'
+	AND MATCH (s.title, s.content) AGAINST (? IN NATURAL LANGUAGE MODE)
+	ORDER BY MATCH (s.title, s.content) AGAINST (? IN NATURAL LANGUAGE MODE) DESC, s.id DESC
+	LIMIT ? OFFSET ?`
+	rows, err := m.DB.QueryContext(ctx, query, q, q, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	snippets := []*models.Snippet{}
+	for rows.Next() {
+		s := &models.Snippet{}
+		err = rows.Scan(&s.ID, &s.UserID, &s.Author, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.Slug, &s.Created, &s.Expires)
+		if err != nil {
+			return nil, 0, err
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
 	}
 
-	return snippets, nil
+	return snippets, total, nil
 }
@@ -0,0 +1,165 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+)
+
+func TestSnippetModelGet(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		id        int
+		wantTitle string
+		wantError error
+	}{
+		{"Valid ID", 1, "An old silent pond", nil},
+		{"Other author", 2, "Over the wintry forest", nil},
+		{"Expired", 3, "", models.ErrNoRecord},
+		{"Non-existent ID", 99, "", models.ErrNoRecord},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := m.Get(ctx, tt.id)
+			if err != tt.wantError {
+				t.Fatalf("want %v; got %v", tt.wantError, err)
+			}
+			if tt.wantError == nil && s.Title != tt.wantTitle {
+				t.Errorf("want title %q; got %q", tt.wantTitle, s.Title)
+			}
+		})
+	}
+}
+
+func TestSnippetModelInsert(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+	ctx := context.Background()
+
+	id, err := m.Insert(ctx, 2, "Haiku", "Light of the moon", "plaintext", models.VisibilityPublic, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.UserID != 2 || s.Author != "Bob Smith" || s.Content != "Light of the moon" {
+		t.Errorf("unexpected snippet %+v", s)
+	}
+	if lifetime := s.Expires.Sub(s.Created); lifetime != 7*24*time.Hour {
+		t.Errorf("want the snippet to expire in 7 days; got %v", lifetime)
+	}
+
+	id, err = m.Insert(ctx, 2, "Unlisted", "Shared by link", "plaintext", models.VisibilityUnlisted, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = m.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Slug == "" {
+		t.Fatal("want a slug for an unlisted snippet")
+	}
+	if _, err = m.GetBySlug(ctx, s.Slug); err != nil {
+		t.Errorf("want snippet by slug %q; got %v", s.Slug, err)
+	}
+}
+
+func TestSnippetModelUpdate(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+	ctx := context.Background()
+
+	before, err := m.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Update(ctx, 1, "A new pond", before.Content, before.Language, before.Visibility, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title != "A new pond" || !s.Expires.Equal(before.Expires) {
+		t.Errorf("want title updated and expiry %v kept; got %q and %v", before.Expires, s.Title, s.Expires)
+	}
+
+	err = m.Update(ctx, 1, "A new pond", before.Content, before.Language, before.Visibility, "365")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err = m.Get(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Expires.After(before.Expires) {
+		t.Errorf("want expiry after %v; got %v", before.Expires, s.Expires)
+	}
+}
+
+func TestSnippetModelList(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		page     int
+		pageSize int
+		wantIDs  []int
+	}{
+		{"Newest first", 1, 10, []int{2, 1}},
+		{"First page", 1, 1, []int{2}},
+		{"Second page", 2, 1, []int{1}},
+		{"Past the end", 3, 1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss, total, err := m.List(ctx, tt.page, tt.pageSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The expired and the private snippets are never listed.
+			if total != 2 {
+				t.Errorf("want total 2; got %d", total)
+			}
+			if len(ss) != len(tt.wantIDs) {
+				t.Fatalf("want %d snippets; got %d", len(tt.wantIDs), len(ss))
+			}
+			for i, s := range ss {
+				if s.ID != tt.wantIDs[i] {
+					t.Errorf("want snippet %d at position %d; got %d", tt.wantIDs[i], i, s.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestSnippetModelDeleteExpired(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+	ctx := context.Background()
+
+	n, err := m.DeleteExpired(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("want 1 snippet purged; got %d", n)
+	}
+	if _, err = m.Get(ctx, 1); err != nil {
+		t.Errorf("want unexpired snippets kept; got %v", err)
+	}
+}
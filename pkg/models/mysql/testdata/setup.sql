@@ -0,0 +1,15 @@
+-- Fixtures loaded into every test database after the migrations. The
+-- password of both users is "pa55word".
+INSERT INTO users (id, name, email, hashed_password, created) VALUES
+(1, 'Alice Jones', 'alice@example.com', '$2a$12$9X8p.fYlkwLRhBc7xKYT2.UygpyAPckw1kf1ooQuIDF5onbCvhwIq', '2021-04-01 10:00:00'),
+(2, 'Bob Smith', 'bob@example.com', '$2a$12$9X8p.fYlkwLRhBc7xKYT2.UygpyAPckw1kf1ooQuIDF5onbCvhwIq', '2021-04-02 10:00:00');
+
+INSERT INTO snippets (id, user_id, title, content, language, visibility, slug, created, expires) VALUES
+(1, 1, 'An old silent pond', 'An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.', 'plaintext', 'public', NULL,
+  DATE_SUB(UTC_TIMESTAMP(), INTERVAL 2 DAY), DATE_ADD(UTC_TIMESTAMP(), INTERVAL 7 DAY)),
+(2, 2, 'Over the wintry forest', 'Over the wintry\nforest, winds howl in rage\nwith no leaves to blow.', 'plaintext', 'public', NULL,
+  DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 DAY), DATE_ADD(UTC_TIMESTAMP(), INTERVAL 7 DAY)),
+(3, 1, 'First autumn morning', 'First autumn morning\nthe mirror I stare into\nshows my father''s face.', 'plaintext', 'public', NULL,
+  DATE_SUB(UTC_TIMESTAMP(), INTERVAL 10 DAY), DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 DAY)),
+(4, 1, 'Private haiku', 'Only for me.', 'plaintext', 'private', NULL,
+  UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL 7 DAY));
@@ -0,0 +1,79 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/migrations"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// newTestDB creates a disposable database on the MySQL server given by the
+// TEST_MYSQL_DSN environment variable, applies the migrations to it and loads
+// the fixtures in testdata/setup.sql. The database is dropped when the test
+// finishes. The DSN must be for a user allowed to create databases, for
+// example "root:secret@tcp(localhost:3306)/". If TEST_MYSQL_DSN isn't set
+// the test is skipped, unless the CI environment variable is set, in which
+// case it fails so that the tests can't silently stop running there.
+func newTestDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		if os.Getenv("CI") != "" {
+			t.Fatal("TEST_MYSQL_DSN must be set when running in CI")
+		}
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DBName = ""
+	server, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	// Give every test its own database so that they can't affect each other.
+	name := fmt.Sprintf("snippetbox_test_%d", time.Now().UnixNano())
+	_, err = server.Exec("CREATE DATABASE " + name + " CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := server.Exec("DROP DATABASE " + name); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// The application opens the database with parseTime, and the fixtures
+	// file holds several statements.
+	cfg.DBName = name
+	cfg.ParseTime = true
+	cfg.MultiStatements = true
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator := &migrations.Migrator{DB: db, Driver: "mysql"}
+	if _, err = migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	setup, err := ioutil.ReadFile("./testdata/setup.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec(string(setup)); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
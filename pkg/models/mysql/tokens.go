@@ -0,0 +1,100 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+	"wilbertopachecob/snippetbox/pkg/models/internal/secret"
+)
+
+type TokenModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Insert creates a new API token for the given user and returns its plaintext
+// value. This is the only time the plaintext is available.
+func (m *TokenModel) Insert(ctx context.Context, userID int, name string) (string, error) {
+	plaintext, err := secret.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `INSERT INTO tokens (user_id, name, hash, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`
+	_, err = m.DB.ExecContext(ctx, query, userID, name, secret.Hash(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return plaintext, nil
+}
+
+// List returns all the API tokens belonging to the given user, newest first.
+func (m *TokenModel) List(ctx context.Context, userID int) ([]*models.Token, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `SELECT id, user_id, name, created FROM tokens WHERE user_id = ? ORDER BY created DESC`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*models.Token{}
+	for rows.Next() {
+		t := &models.Token{}
+		err = rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Created)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Delete revokes one of the user's API tokens. If the user has no token with
+// the given id we return models.ErrNoRecord.
+func (m *TokenModel) Delete(ctx context.Context, userID, ID int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `DELETE FROM tokens WHERE id = ? AND user_id = ?`
+	result, err := m.DB.ExecContext(ctx, query, ID, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// Authenticate returns the id of the user owning the given plaintext token,
+// or models.ErrNoRecord if the token doesn't exist.
+func (m *TokenModel) Authenticate(ctx context.Context, plaintext string) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `SELECT user_id FROM tokens WHERE hash = ?`
+	var userID int
+	err := m.DB.QueryRowContext(ctx, query, secret.Hash(plaintext)).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, models.ErrNoRecord
+		}
+		return 0, err
+	}
+	return userID, nil
+}
@@ -0,0 +1,56 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+	"wilbertopachecob/snippetbox/pkg/totp"
+)
+
+func TestTwoFactorModel(t *testing.T) {
+	db := newTestDB(t)
+	m := &TwoFactorModel{DB: db}
+	ctx := context.Background()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := m.Enable(ctx, 1, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		verify    func() error
+		wantError error
+	}{
+		{"Valid code", func() error { return m.Verify(ctx, 1, code) }, nil},
+		{"Reused code", func() error { return m.Verify(ctx, 1, code) }, models.ErrInvalidCredentials},
+		{"Wrong code", func() error { return m.Verify(ctx, 1, "000000") }, models.ErrInvalidCredentials},
+		{"Other user", func() error { return m.Verify(ctx, 2, code) }, models.ErrInvalidCredentials},
+		{"Recovery code", func() error { return m.UseRecoveryCode(ctx, 1, codes[0]) }, nil},
+		{"Reused recovery code", func() error { return m.UseRecoveryCode(ctx, 1, codes[0]) }, models.ErrInvalidCredentials},
+		{"Recovery code of another user", func() error { return m.UseRecoveryCode(ctx, 2, codes[1]) }, models.ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		if err := tt.verify(); err != tt.wantError {
+			t.Errorf("%s: want %v; got %v", tt.name, tt.wantError, err)
+		}
+	}
+
+	if err = m.Disable(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := m.RecoveryCodesLeft(ctx, 1); n != 0 {
+		t.Errorf("want the recovery codes deleted; got %d", n)
+	}
+}
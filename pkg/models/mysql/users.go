@@ -1,8 +1,11 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
+	"time"
 	"wilbertopachecob/snippetbox/pkg/models"
+	"wilbertopachecob/snippetbox/pkg/models/internal/secret"
 
 	"github.com/go-sql-driver/mysql"
 	"golang.org/x/crypto/bcrypt"
@@ -10,58 +13,150 @@ import (
 
 type UserModel struct {
 	DB *sql.DB
+	// Timeout bounds how long each query may take, in the same way as
+	// SnippetModel.Timeout. Hashing passwords doesn't count towards it.
+	Timeout time.Duration
+	// After MaxFailedLogins failed attempts in a row, Authenticate refuses
+	// to log in to the account for LockoutDuration. Zero disables the
+	// lockout.
+	MaxFailedLogins int
+	LockoutDuration time.Duration
 }
 
-func (m *UserModel) Insert(name, email, password string) error {
+// Insert adds a new user and returns their id.
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (int, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	query := `INSERT INTO USERS (name, email, hashed_password, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `INSERT INTO users (name, email, hashed_password, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`
 	// Use the Exec() method to insert the user details and hashed password
 	// into the users table. If this returns an error, we try to type assert
 	// it to a *mysql.MySQLError object so we can check if the error number is
 	// 1062 and, if it is, we also check whether or not the error relates to
 	// our users_uc_email key by checking the contents of the message string.
 	// If it does, we return an ErrDuplicateEmail error. Otherwise, we just
-	// return the original error (or nil if everything worked).
-	_, err = m.DB.Exec(query, name, email, hashedPassword)
+	// return the original error.
+	result, err := m.DB.ExecContext(ctx, query, name, email, hashedPassword)
 	if err != nil {
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok {
 			if mysqlErr.Number == 1062 {
-				return models.ErrDuplicateEmail
+				return 0, models.ErrDuplicateEmail
 			}
 		}
+		return 0, err
 	}
-	return err
+
+	ID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(ID), nil
 }
 
 // We'll use the Authenticate method to verify whether a user exists with
 // the provided email address and password. This will return the relevant
-// user ID if they do.
-func (m *UserModel) Authenticate(email, password string) (int, error) {
-	query := `SELECT id, hashed_password FROM users WHERE email = ?`
+// user ID if they do. If the account is locked we return
+// models.ErrAccountLocked without checking the password, and if it has been
+// disabled we return models.ErrAccountDisabled.
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	qctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `SELECT id, hashed_password, COALESCE(locked_until > UTC_TIMESTAMP(), FALSE), disabled
+	FROM users WHERE email = ?`
 	var hashedPassword string
 	var id int
-	err := m.DB.QueryRow(query, email).Scan(&id, &hashedPassword)
+	var locked, disabled bool
+	err := m.DB.QueryRowContext(qctx, query, email).Scan(&id, &hashedPassword, &locked, &disabled)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			bcrypt.CompareHashAndPassword(secret.DummyPasswordHash, []byte(password))
 			return 0, models.ErrNoRecord
 		}
 		return 0, err
 	}
+	if locked {
+		return 0, models.ErrAccountLocked
+	}
 	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	if err != nil {
+		if err := m.recordFailedLogin(ctx, id); err != nil {
+			return 0, err
+		}
 		return 0, models.ErrInvalidCredentials
 	}
+	// Only tell the user their account is disabled once they have proved
+	// who they are.
+	if disabled {
+		return 0, models.ErrAccountDisabled
+	}
+
+	// Reset the count of failed attempts, but only write to the database if
+	// there were any.
+	qctx, cancel = withTimeout(ctx, m.Timeout)
+	defer cancel()
+	query = `UPDATE users SET failed_logins = 0, locked_until = NULL
+	WHERE id = ? AND (failed_logins > 0 OR locked_until IS NOT NULL)`
+	if _, err = m.DB.ExecContext(qctx, query, id); err != nil {
+		return 0, err
+	}
 	return id, nil
 }
 
-func (m *UserModel) Get(ID int) (*models.User, error) {
-	query := `SELECT id, email, name, created FROM users WHERE id = ?`
+// recordFailedLogin counts a failed login attempt for the given user. When
+// the count reaches MaxFailedLogins the account is locked and the count
+// starts again.
+func (m *UserModel) recordFailedLogin(ctx context.Context, ID int) error {
+	if m.MaxFailedLogins <= 0 {
+		return nil
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	// MySQL assigns the columns from left to right, so locked_until has to
+	// be set before failed_logins is changed.
+	query := `UPDATE users SET
+	locked_until = IF(failed_logins + 1 >= ?, UTC_TIMESTAMP() + INTERVAL ? SECOND, locked_until),
+	failed_logins = IF(failed_logins + 1 >= ?, 0, failed_logins + 1)
+	WHERE id = ?`
+	seconds := int(m.LockoutDuration / time.Second)
+	_, err := m.DB.ExecContext(ctx, query, m.MaxFailedLogins, seconds, m.MaxFailedLogins, ID)
+	return err
+}
+
+func (m *UserModel) Get(ctx context.Context, ID int) (*models.User, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `SELECT id, email, name, created, role, disabled FROM users WHERE id = ?`
+	var user models.User
+	err := m.DB.QueryRowContext(ctx, query, ID).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Created, &user.Role, &user.Disabled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, models.ErrNoRecord
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetByEmail returns the user with the given email address, or
+// models.ErrNoRecord if there isn't one.
+func (m *UserModel) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `SELECT id, email, name, created, role, disabled FROM users WHERE email = ?`
 	var user models.User
-	err := m.DB.QueryRow(query, ID).Scan(&user.ID, &user.Email, &user.Name, &user.Created)
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Created, &user.Role, &user.Disabled)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, models.ErrNoRecord
@@ -70,3 +165,153 @@ func (m *UserModel) Get(ID int) (*models.User, error) {
 	}
 	return &user, nil
 }
+
+// UpdatePassword replaces the password of the given user with a bcrypt hash of
+// the new one.
+func (m *UserModel) UpdatePassword(ctx context.Context, ID int, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `UPDATE users SET hashed_password = ? WHERE id = ?`
+	result, err := m.DB.ExecContext(ctx, query, hashedPassword, ID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// UpdateProfile changes the name and email address of the given user. If the
+// email address is already used by another account we return
+// models.ErrDuplicateEmail.
+func (m *UserModel) UpdateProfile(ctx context.Context, ID int, name, email string) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `UPDATE users SET name = ?, email = ? WHERE id = ?`
+	_, err := m.DB.ExecContext(ctx, query, name, email, ID)
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok {
+			if mysqlErr.Number == 1062 {
+				return models.ErrDuplicateEmail
+			}
+		}
+	}
+	return err
+}
+
+// ChangePassword sets a new password for the given user after checking their
+// current one, in the same way as Authenticate. If the current password is
+// wrong we return models.ErrInvalidCredentials.
+func (m *UserModel) ChangePassword(ctx context.Context, ID int, currentPassword, newPassword string) error {
+	qctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `SELECT hashed_password FROM users WHERE id = ?`
+	var hashedPassword string
+	err := m.DB.QueryRowContext(qctx, query, ID).Scan(&hashedPassword)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.ErrNoRecord
+		}
+		return err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(currentPassword))
+	if err != nil {
+		return models.ErrInvalidCredentials
+	}
+	return m.UpdatePassword(ctx, ID, newPassword)
+}
+
+// List returns a page of users, in the order they signed up, along with the
+// total number of matching users. If q isn't empty only the users whose name
+// or email address contains it are returned.
+func (m *UserModel) List(ctx context.Context, q string, page, pageSize int) ([]*models.User, int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	where := `WHERE ? = '' OR name LIKE CONCAT('%', ?, '%') OR email LIKE CONCAT('%', ?, '%')`
+	var total int
+	err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM users `+where, q, q, q).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, email, name, created, role, disabled FROM users ` + where +
+		` ORDER BY id LIMIT ? OFFSET ?`
+	rows, err := m.DB.QueryContext(ctx, query, q, q, q, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		u := &models.User{}
+		err = rows.Scan(&u.ID, &u.Email, &u.Name, &u.Created, &u.Role, &u.Disabled)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// SetRole changes the role of the given user. The role must be one of
+// models.Roles.
+func (m *UserModel) SetRole(ctx context.Context, ID int, role string) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE users SET role = ? WHERE id = ?`, role, ID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	// MySQL doesn't count rows which already had the new value, so make
+	// sure the user exists when nothing changed.
+	if n == 0 {
+		_, err = m.Get(ctx, ID)
+	}
+	return err
+}
+
+// SetDisabled disables or enables the given user. Disabled users can't log
+// in.
+func (m *UserModel) SetDisabled(ctx context.Context, ID int, disabled bool) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE users SET disabled = ? WHERE id = ?`, disabled, ID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	// MySQL doesn't count rows which already had the new value, so make
+	// sure the user exists when nothing changed.
+	if n == 0 {
+		_, err = m.Get(ctx, ID)
+	}
+	return err
+}
@@ -0,0 +1,187 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+)
+
+func TestUserModelInsert(t *testing.T) {
+	db := newTestDB(t)
+	m := &UserModel{DB: db}
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		email     string
+		wantError error
+	}{
+		{"New email", "carol@example.com", nil},
+		{"Duplicate email", "alice@example.com", models.ErrDuplicateEmail},
+		{"Duplicate email in another case", "ALICE@example.com", models.ErrDuplicateEmail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.Insert(ctx, "Carol", tt.email, "pa55word")
+			if err != tt.wantError {
+				t.Errorf("want %v; got %v", tt.wantError, err)
+			}
+		})
+	}
+}
+
+func TestUserModelAuthenticate(t *testing.T) {
+	db := newTestDB(t)
+	m := &UserModel{DB: db}
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		email     string
+		password  string
+		wantID    int
+		wantError error
+	}{
+		{"Valid", "alice@example.com", "pa55word", 1, nil},
+		{"Other user", "bob@example.com", "pa55word", 2, nil},
+		{"Wrong password", "alice@example.com", "wrong", 0, models.ErrInvalidCredentials},
+		{"Unknown email", "nobody@example.com", "pa55word", 0, models.ErrNoRecord},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := m.Authenticate(ctx, tt.email, tt.password)
+			if err != tt.wantError {
+				t.Errorf("want %v; got %v", tt.wantError, err)
+			}
+			if id != tt.wantID {
+				t.Errorf("want id %d; got %d", tt.wantID, id)
+			}
+		})
+	}
+}
+
+func TestUserModelGet(t *testing.T) {
+	db := newTestDB(t)
+	m := &UserModel{DB: db}
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		id        int
+		wantUser  *models.User
+		wantError error
+	}{
+		{
+			name: "Valid ID",
+			id:   1,
+			wantUser: &models.User{
+				ID:      1,
+				Name:    "Alice Jones",
+				Email:   "alice@example.com",
+				Created: time.Date(2021, 4, 1, 10, 0, 0, 0, time.UTC),
+			},
+		},
+		{"Zero ID", 0, nil, models.ErrNoRecord},
+		{"Non-existent ID", 99, nil, models.ErrNoRecord},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := m.Get(ctx, tt.id)
+			if err != tt.wantError {
+				t.Fatalf("want %v; got %v", tt.wantError, err)
+			}
+			if tt.wantUser == nil {
+				return
+			}
+			if user.ID != tt.wantUser.ID || user.Name != tt.wantUser.Name ||
+				user.Email != tt.wantUser.Email || !user.Created.Equal(tt.wantUser.Created) {
+				t.Errorf("want %+v; got %+v", tt.wantUser, user)
+			}
+		})
+	}
+}
+
+func TestUserModelLockout(t *testing.T) {
+	db := newTestDB(t)
+	m := &UserModel{DB: db, MaxFailedLogins: 2, LockoutDuration: time.Hour}
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		password  string
+		wantError error
+	}{
+		{"Failure 1", "wrong", models.ErrInvalidCredentials},
+		{"Success resets the count", "pa55word", nil},
+		{"Failure 2", "wrong", models.ErrInvalidCredentials},
+		{"Failure 3 locks the account", "wrong", models.ErrInvalidCredentials},
+		{"Locked with the right password", "pa55word", models.ErrAccountLocked},
+	}
+
+	for _, tt := range tests {
+		_, err := m.Authenticate(ctx, "alice@example.com", tt.password)
+		if err != tt.wantError {
+			t.Fatalf("%s: want %v; got %v", tt.name, tt.wantError, err)
+		}
+	}
+
+	// The other accounts aren't affected.
+	if _, err := m.Authenticate(ctx, "bob@example.com", "pa55word"); err != nil {
+		t.Errorf("want %v; got %v", nil, err)
+	}
+}
+
+func TestUserModelAdmin(t *testing.T) {
+	db := newTestDB(t)
+	m := &UserModel{DB: db}
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		q         string
+		wantTotal int
+	}{
+		{"Everybody", "", 2},
+		{"By name", "smith", 1},
+		{"By email", "alice@", 1},
+		{"No match", "carol", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, total, err := m.List(ctx, tt.q, 1, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != tt.wantTotal || len(users) != tt.wantTotal {
+				t.Errorf("want %d users; got %d of %d", tt.wantTotal, len(users), total)
+			}
+		})
+	}
+
+	if err := m.SetRole(ctx, 2, models.RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	// Setting the role a user already has isn't an error.
+	if err := m.SetRole(ctx, 2, models.RoleModerator); err != nil {
+		t.Errorf("want no error; got %v", err)
+	}
+	u, err := m.Get(ctx, 2)
+	if err != nil || u.Role != models.RoleModerator {
+		t.Errorf("want a moderator; got %+v, %v", u, err)
+	}
+
+	if err = m.SetDisabled(ctx, 2, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Authenticate(ctx, "bob@example.com", "pa55word"); err != models.ErrAccountDisabled {
+		t.Errorf("want %v; got %v", models.ErrAccountDisabled, err)
+	}
+
+	if err = m.SetDisabled(ctx, 99, true); err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+}
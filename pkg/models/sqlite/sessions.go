@@ -0,0 +1,156 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+	"wilbertopachecob/snippetbox/pkg/models/internal/secret"
+)
+
+// maxUserAgent is the longest user agent stored, the same as the length of
+// the user_agent column in MySQL. Longer user agents are truncated.
+const maxUserAgent = 255
+
+// SessionModel stores the login sessions of users.
+type SessionModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Insert starts a new session for the given user, valid for ttl, and returns
+// the plaintext token which identifies it. Like API tokens, only a hash of
+// the token is stored.
+func (m *SessionModel) Insert(ctx context.Context, userID int, ipAddress, userAgent string, ttl time.Duration) (string, error) {
+	plaintext, err := secret.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	if len(userAgent) > maxUserAgent {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgent], "")
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `INSERT INTO sessions (user_id, hash, ip_address, user_agent, created, last_seen, expires)
+	VALUES (?, ?, ?, ?, datetime('now'), datetime('now'), datetime('now', ? || ' seconds'))`
+	_, err = m.DB.ExecContext(ctx, query, userID, secret.Hash(plaintext), ipAddress, userAgent, int(ttl.Seconds()))
+	if err != nil {
+		return "", err
+	}
+	return plaintext, nil
+}
+
+// Get returns the session identified by the given plaintext token. If the
+// session doesn't exist, because it was revoked, or it has expired we return
+// models.ErrNoRecord.
+func (m *SessionModel) Get(ctx context.Context, plaintext string) (*models.Session, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `SELECT id, user_id, ip_address, user_agent, created, last_seen, expires FROM sessions
+	WHERE hash = ? AND expires > datetime('now')`
+	s := &models.Session{}
+	err := m.DB.QueryRowContext(ctx, query, secret.Hash(plaintext)).Scan(
+		&s.ID, &s.UserID, &s.IPAddress, &s.UserAgent, &s.Created, &s.LastSeen, &s.Expires)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, models.ErrNoRecord
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// Touch records that the session is still in use. To save writes the time is
+// only updated once a minute.
+func (m *SessionModel) Touch(ctx context.Context, ID int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `UPDATE sessions SET last_seen = datetime('now')
+	WHERE id = ? AND last_seen < datetime('now', '-1 minutes')`
+	_, err := m.DB.ExecContext(ctx, query, ID)
+	return err
+}
+
+// List returns the unexpired sessions of the given user, most recently used
+// first.
+func (m *SessionModel) List(ctx context.Context, userID int) ([]*models.Session, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `SELECT id, user_id, ip_address, user_agent, created, last_seen, expires FROM sessions
+	WHERE user_id = ? AND expires > datetime('now') ORDER BY last_seen DESC, id DESC`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		s := &models.Session{}
+		err = rows.Scan(&s.ID, &s.UserID, &s.IPAddress, &s.UserAgent, &s.Created, &s.LastSeen, &s.Expires)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Delete revokes one of the user's sessions. If the user has no session with
+// the given id we return models.ErrNoRecord.
+func (m *SessionModel) Delete(ctx context.Context, userID, ID int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `DELETE FROM sessions WHERE id = ? AND user_id = ?`
+	result, err := m.DB.ExecContext(ctx, query, ID, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// DeleteAll revokes every session of the given user and returns how many
+// there were.
+func (m *SessionModel) DeleteAll(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// DeleteExpired permanently deletes the sessions which have expired and
+// returns how many there were.
+func (m *SessionModel) DeleteExpired(ctx context.Context) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE expires <= datetime('now')`)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
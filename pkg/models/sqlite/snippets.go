@@ -0,0 +1,225 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+	"wilbertopachecob/snippetbox/pkg/models/internal/secret"
+)
+
+type SnippetModel struct {
+	DB *sql.DB
+	// Timeout bounds how long each method may spend on the database, on top
+	// of any deadline the context passed to it already has. Zero means no
+	// extra limit.
+	Timeout time.Duration
+}
+
+// withTimeout returns a copy of ctx which is cancelled after timeout, if
+// timeout is positive.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// newSlug returns a new slug for a snippet that is being made unlisted, or
+// nil if the snippet has another visibility.
+func newSlug(visibility string) (interface{}, error) {
+	if visibility != models.VisibilityUnlisted {
+		return nil, nil
+	}
+	return secret.RandomString(16)
+}
+
+// This will insert a new snippet into the database, owned by the user with
+// the given id. Unlisted snippets are given a random slug.
+func (m *SnippetModel) Insert(ctx context.Context, userID int, title, content, language, visibility, expires string) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	slug, err := newSlug(visibility)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `INSERT INTO snippets (user_id, title, content, language, visibility, slug, created, expires)
+	VALUES (?, ?, ?, ?, ?, ?, datetime('now'), datetime('now', ? || ' days'))`
+
+	result, err := m.DB.ExecContext(ctx, query, userID, title, content, language, visibility, slug, expires)
+	if err != nil {
+		return 0, err
+	}
+
+	ID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(ID), nil
+}
+
+// This will update the title, content, language, visibility and expiry of an
+// existing snippet. An empty expires keeps the current expiry. A snippet that
+// becomes unlisted keeps its existing slug if it has one.
+func (m *SnippetModel) Update(ctx context.Context, ID int, title, content, language, visibility, expires string) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	slug, err := newSlug(visibility)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE snippets SET title = ?, content = ?, language = ?, visibility = ?,
+	slug = COALESCE(slug, ?), expires = CASE WHEN ? = '' THEN expires ELSE datetime('now', ? || ' days') END
+	WHERE id = ?`
+
+	_, err = m.DB.ExecContext(ctx, query, title, content, language, visibility, slug, expires, expires, ID)
+	return err
+}
+
+// This will delete a specific snippet based on its id. If there is no
+// snippet with the given id we return models.ErrNoRecord.
+func (m *SnippetModel) Delete(ctx context.Context, ID int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM snippets WHERE id = ?`, ID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// This will permanently remove every expired snippet and return how many
+// were deleted.
+func (m *SnippetModel) DeleteExpired(ctx context.Context) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM snippets WHERE expires <= datetime('now')`)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+const selectSnippets = `SELECT s.id, s.user_id, u.name, s.title, s.content, s.language, s.visibility,
+	COALESCE(s.slug, ''), s.created, s.expires
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id`
+
+// scanSnippet copies the columns of selectSnippets into a new snippet.
+func scanSnippet(row interface{ Scan(...interface{}) error }) (*models.Snippet, error) {
+	s := &models.Snippet{}
+	err := row.Scan(&s.ID, &s.UserID, &s.Author, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.Slug, &s.Created, &s.Expires)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNoRecord
+	} else if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// This will return a specific snippet based on its id.
+func (m *SnippetModel) Get(ctx context.Context, ID int) (*models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := selectSnippets + ` WHERE s.expires > datetime('now') AND s.id = ?`
+	return scanSnippet(m.DB.QueryRowContext(ctx, query, ID))
+}
+
+// This will return a specific snippet based on its slug.
+func (m *SnippetModel) GetBySlug(ctx context.Context, slug string) (*models.Snippet, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := selectSnippets + ` WHERE s.expires > datetime('now') AND s.slug = ?`
+	return scanSnippet(m.DB.QueryRowContext(ctx, query, slug))
+}
+
+// list returns one page of the snippets matching the where clause along with
+// the total number of matches.
+func (m *SnippetModel) list(ctx context.Context, where string, args []interface{}, page, pageSize int) ([]*models.Snippet, int, error) {
+	var total int
+	err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM snippets s WHERE `+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := selectSnippets + ` WHERE ` + where + ` ORDER BY s.created DESC, s.id DESC LIMIT ? OFFSET ?`
+	rows, err := m.DB.QueryContext(ctx, query, append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	snippets := []*models.Snippet{}
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return snippets, total, nil
+}
+
+// This will return one page of public snippets, most recently created first,
+// along with the total number of unexpired public snippets. Pages are
+// numbered from 1.
+func (m *SnippetModel) List(ctx context.Context, page, pageSize int) ([]*models.Snippet, int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	return m.list(ctx, `s.expires > datetime('now') AND s.visibility = 'public'`, nil, page, pageSize)
+}
+
+// likeEscaper escapes the wildcard characters of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// This will return one page of the unexpired public snippets whose title or
+// content contains any of the words in q, along with the total number of
+// matches. SQLite has no equivalent of MySQL's natural language full-text
+// search, so unlike the MySQL model results are ordered by creation date
+// rather than relevance.
+func (m *SnippetModel) Search(ctx context.Context, q string, page, pageSize int) ([]*models.Snippet, int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	words := strings.Fields(q)
+	if len(words) == 0 {
+		return []*models.Snippet{}, 0, nil
+	}
+
+	var matches []string
+	var args []interface{}
+	for _, w := range words {
+		pattern := "%" + likeEscaper.Replace(w) + "%"
+		matches = append(matches, `s.title LIKE ? ESCAPE '\' OR s.content LIKE ? ESCAPE '\'`)
+		args = append(args, pattern, pattern)
+	}
+
+	where := `s.expires > datetime('now') AND s.visibility = 'public' AND (` + strings.Join(matches, " OR ") + `)`
+	return m.list(ctx, where, args, page, pageSize)
+}
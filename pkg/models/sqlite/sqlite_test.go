@@ -0,0 +1,581 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/config"
+	"wilbertopachecob/snippetbox/pkg/migrations"
+	"wilbertopachecob/snippetbox/pkg/models"
+	"wilbertopachecob/snippetbox/pkg/totp"
+)
+
+// newTestDB returns a new database file with the migrations applied and a
+// single user, with id 1, who owns the snippets created by the tests.
+func newTestDB(t *testing.T) *sql.DB {
+	dsn := config.DB{Driver: config.DriverSQLite, Database: filepath.Join(t.TempDir(), "test.db")}.DSN()
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator := &migrations.Migrator{DB: db, Driver: config.DriverSQLite}
+	if _, err = migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	users := &UserModel{DB: db}
+	ctx := context.Background()
+	if _, err = users.Insert(ctx, "Alice", "alice@example.com", "pa55word"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSnippetModel(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+	ctx := context.Background()
+
+	id, err := m.Insert(ctx, 1, "An old pond", "A frog jumps in", "plaintext", models.VisibilityPublic, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title != "An old pond" || s.Author != "Alice" || !s.Expires.After(s.Created) {
+		t.Errorf("unexpected snippet %+v", s)
+	}
+
+	if _, err = m.Get(ctx, id+1); err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+
+	unlisted, err := m.Insert(ctx, 1, "Secret", "Hidden pond", "plaintext", models.VisibilityUnlisted, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = m.Get(ctx, unlisted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.GetBySlug(ctx, s.Slug); err != nil {
+		t.Errorf("want snippet by slug %q; got %v", s.Slug, err)
+	}
+
+	ss, total, err := m.List(ctx, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(ss) != 1 || ss[0].ID != id {
+		t.Errorf("want only snippet %d listed; got %d of %d", id, len(ss), total)
+	}
+
+	ss, total, err = m.Search(ctx, "frog 100%", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(ss) != 1 || ss[0].ID != id {
+		t.Errorf("want only snippet %d found; got %d of %d", id, len(ss), total)
+	}
+}
+
+func TestSnippetModelExpiry(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+	ctx := context.Background()
+
+	id, err := m.Insert(ctx, 1, "Expired", "Gone", "plaintext", models.VisibilityPublic, "-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = m.Get(ctx, id); err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+	if _, total, _ := m.List(ctx, 1, 10); total != 0 {
+		t.Errorf("want no snippets listed; got %d", total)
+	}
+
+	n, err := m.DeleteExpired(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("want 1 snippet purged; got %d", n)
+	}
+}
+
+func TestSnippetModelUpdate(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+	ctx := context.Background()
+
+	id, err := m.Insert(ctx, 1, "An old pond", "A frog jumps in", "plaintext", models.VisibilityPublic, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := m.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Update(ctx, id, "A new pond", "A frog jumps in", "plaintext", models.VisibilityPublic, ""); err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title != "A new pond" || !s.Expires.Equal(before.Expires) {
+		t.Errorf("want title updated and expiry %v kept; got %q and %v", before.Expires, s.Title, s.Expires)
+	}
+
+	if err = m.Update(ctx, id, "A new pond", "A frog jumps in", "plaintext", models.VisibilityPublic, "365"); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = m.Get(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Expires.After(before.Expires) {
+		t.Errorf("want expiry after %v; got %v", before.Expires, s.Expires)
+	}
+}
+
+func TestSnippetModelTimeout(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db, Timeout: time.Nanosecond}
+
+	_, err := m.Get(context.Background(), 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want %v; got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestTokenModelTimeout(t *testing.T) {
+	db := newTestDB(t)
+	m := &TokenModel{DB: db, Timeout: time.Nanosecond}
+
+	_, err := m.Authenticate(context.Background(), "token")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want %v; got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestUserModel(t *testing.T) {
+	db := newTestDB(t)
+	m := &UserModel{DB: db}
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		email string
+		pw    string
+		want  error
+	}{
+		{"Valid", "alice@example.com", "pa55word", nil},
+		{"Email is case insensitive", "ALICE@example.com", "pa55word", nil},
+		{"Wrong password", "alice@example.com", "wrong", models.ErrInvalidCredentials},
+		{"Unknown email", "bob@example.com", "pa55word", models.ErrNoRecord},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.Authenticate(ctx, tt.email, tt.pw)
+			if err != tt.want {
+				t.Errorf("want %v; got %v", tt.want, err)
+			}
+		})
+	}
+
+	_, err := m.Insert(ctx, "Alice again", "alice@example.com", "pa55word")
+	if err != models.ErrDuplicateEmail {
+		t.Errorf("want %v; got %v", models.ErrDuplicateEmail, err)
+	}
+
+	id, err := m.Insert(ctx, "Bob", "bob@example.com", "pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 2 {
+		t.Errorf("want id 2; got %d", id)
+	}
+	err = m.UpdateProfile(ctx, 2, "Bob", "alice@example.com")
+	if err != models.ErrDuplicateEmail {
+		t.Errorf("want %v; got %v", models.ErrDuplicateEmail, err)
+	}
+
+	if _, err = m.Get(ctx, 3); err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+}
+
+func TestResetTokenModel(t *testing.T) {
+	db := newTestDB(t)
+	m := &ResetTokenModel{DB: db}
+	users := &UserModel{DB: db}
+	ctx := context.Background()
+
+	if _, err := m.ResetPassword(ctx, "unknown", "newPa55word"); err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+
+	token, err := m.Insert(ctx, 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := m.ResetPassword(ctx, token, "newPa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Errorf("want user 1; got %d", id)
+	}
+	if _, err = users.Authenticate(ctx, "alice@example.com", "newPa55word"); err != nil {
+		t.Errorf("want the new password to work; got %v", err)
+	}
+
+	if _, err = m.ResetPassword(ctx, token, "otherPa55word"); err != models.ErrNoRecord {
+		t.Errorf("want a used token to give %v; got %v", models.ErrNoRecord, err)
+	}
+}
+
+func TestUserModelLockout(t *testing.T) {
+	db := newTestDB(t)
+	m := &UserModel{DB: db, MaxFailedLogins: 3, LockoutDuration: time.Hour}
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		pw   string
+		want error
+	}{
+		{"First failure", "wrong", models.ErrInvalidCredentials},
+		{"Success resets the count", "pa55word", nil},
+		{"Failure 1", "wrong", models.ErrInvalidCredentials},
+		{"Failure 2", "wrong", models.ErrInvalidCredentials},
+		{"Failure 3 locks the account", "wrong", models.ErrInvalidCredentials},
+		{"Locked with the right password", "pa55word", models.ErrAccountLocked},
+	}
+
+	for _, tt := range tests {
+		_, err := m.Authenticate(ctx, "alice@example.com", tt.pw)
+		if err != tt.want {
+			t.Fatalf("%s: want %v; got %v", tt.name, tt.want, err)
+		}
+	}
+
+	// Once the lockout has expired the account can be used again.
+	_, err := db.Exec(`UPDATE users SET locked_until = datetime('now', '-1 seconds')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Authenticate(ctx, "alice@example.com", "pa55word"); err != nil {
+		t.Errorf("want the lockout to expire; got %v", err)
+	}
+}
+
+func TestUserModelAdmin(t *testing.T) {
+	db := newTestDB(t)
+	m := &UserModel{DB: db}
+	ctx := context.Background()
+
+	if _, err := m.Insert(ctx, "Bob", "bob@example.com", "pa55word"); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := m.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Role != models.RoleUser || u.Disabled {
+		t.Errorf("want an enabled user; got role %q disabled %v", u.Role, u.Disabled)
+	}
+
+	tests := []struct {
+		name      string
+		q         string
+		wantTotal int
+	}{
+		{"Everybody", "", 2},
+		{"By name", "bob", 1},
+		{"By email", "alice@", 1},
+		{"No match", "carol", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, total, err := m.List(ctx, tt.q, 1, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != tt.wantTotal || len(users) != tt.wantTotal {
+				t.Errorf("want %d users; got %d of %d", tt.wantTotal, len(users), total)
+			}
+		})
+	}
+
+	if err = m.SetRole(ctx, 2, models.RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	if u, err = m.GetByEmail(ctx, "bob@example.com"); err != nil || u.Role != models.RoleModerator {
+		t.Errorf("want a moderator; got %+v, %v", u, err)
+	}
+
+	if err = m.SetDisabled(ctx, 2, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Authenticate(ctx, "bob@example.com", "wrong"); err != models.ErrInvalidCredentials {
+		t.Errorf("want %v with the wrong password; got %v", models.ErrInvalidCredentials, err)
+	}
+	if _, err = m.Authenticate(ctx, "bob@example.com", "pa55word"); err != models.ErrAccountDisabled {
+		t.Errorf("want %v; got %v", models.ErrAccountDisabled, err)
+	}
+	if err = m.SetDisabled(ctx, 2, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Authenticate(ctx, "bob@example.com", "pa55word"); err != nil {
+		t.Errorf("want the account enabled again; got %v", err)
+	}
+
+	if err = m.SetDisabled(ctx, 99, true); err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+}
+
+func TestAuditModel(t *testing.T) {
+	db := newTestDB(t)
+	m := &AuditModel{DB: db}
+	ctx := context.Background()
+
+	if err := m.Insert(ctx, 1, "192.0.2.1", strings.Repeat("a", 300), "admin.user.disable", "user:2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Insert(ctx, 0, "", "cli", "user.login.failure", "email:"+strings.Repeat("a", 300)); err != nil {
+		t.Fatal(err)
+	}
+
+	var withActor, withoutActor, longestAgent, longestTarget int
+	err := db.QueryRow(`SELECT COUNT(actor_id), COUNT(*) - COUNT(actor_id), MAX(length(user_agent)), MAX(length(target))
+	FROM audit_events`).Scan(&withActor, &withoutActor, &longestAgent, &longestTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withActor != 1 || withoutActor != 1 {
+		t.Errorf("want one event with an actor and one without; got %d and %d", withActor, withoutActor)
+	}
+	if longestAgent != maxUserAgent {
+		t.Errorf("want the user agent truncated to %d; got %d", maxUserAgent, longestAgent)
+	}
+	if longestTarget != maxAuditTarget {
+		t.Errorf("want the target truncated to %d; got %d", maxAuditTarget, longestTarget)
+	}
+
+	// Move the first event back in time to check the date filters.
+	if _, err = db.Exec(`UPDATE audit_events SET created = '2021-04-01 10:00:00' WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		since   time.Time
+		until   time.Time
+		wantIDs []int
+	}{
+		{"Everything", time.Time{}, time.Time{}, []int{2, 1}},
+		{"Since", day.AddDate(0, 0, 1), time.Time{}, []int{2}},
+		{"Until", time.Time{}, day.AddDate(0, 0, 1), []int{1}},
+		{"Empty range", day.AddDate(0, 0, 1), day.AddDate(0, 0, 2), []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, total, err := m.List(ctx, tt.since, tt.until, 1, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []int{}
+			for _, e := range events {
+				ids = append(ids, e.ID)
+			}
+			if total != len(tt.wantIDs) || fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("want events %v; got %v of %d", tt.wantIDs, ids, total)
+			}
+		})
+	}
+
+	events, _, err := m.List(ctx, time.Time{}, time.Time{}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := events[1]; e.ActorID != 1 || e.ActorEmail != "alice@example.com" || e.Event != "admin.user.disable" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if e := events[0]; e.ActorID != 0 || e.ActorEmail != "" {
+		t.Errorf("want an event without an actor; got %+v", e)
+	}
+
+	// Export goes oldest first, and stops at the first error.
+	var exported []int
+	err = m.Export(ctx, time.Time{}, time.Time{}, func(e *models.AuditEvent) error {
+		exported = append(exported, e.ID)
+		return nil
+	})
+	if err != nil || fmt.Sprint(exported) != "[1 2]" {
+		t.Errorf("want events [1 2] exported; got %v, %v", exported, err)
+	}
+	errStop := errors.New("stop")
+	err = m.Export(ctx, time.Time{}, time.Time{}, func(e *models.AuditEvent) error { return errStop })
+	if err != errStop {
+		t.Errorf("want %v; got %v", errStop, err)
+	}
+}
+
+func TestTwoFactorModel(t *testing.T) {
+	db := newTestDB(t)
+	m := &TwoFactorModel{DB: db}
+	ctx := context.Background()
+
+	secret, err := m.Secret(ctx, 1)
+	if err != nil || secret != "" {
+		t.Fatalf("want two-factor disabled; got %q, %v", secret, err)
+	}
+	if err = m.Verify(ctx, 1, "123456"); err != models.ErrInvalidCredentials {
+		t.Errorf("want %v while disabled; got %v", models.ErrInvalidCredentials, err)
+	}
+
+	secret, err = totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := m.Enable(ctx, 1, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("want %d recovery codes; got %d", recoveryCodeCount, len(codes))
+	}
+	if got, _ := m.Secret(ctx, 1); got != secret {
+		t.Errorf("want secret %q; got %q", secret, got)
+	}
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Verify(ctx, 1, code); err != nil {
+		t.Errorf("want a valid code; got %v", err)
+	}
+	if err = m.Verify(ctx, 1, code); err != models.ErrInvalidCredentials {
+		t.Errorf("want a used code refused; got %v", err)
+	}
+
+	// Recovery codes can be typed in upper case and without the dash, but
+	// only once.
+	typed := strings.ToUpper(strings.Replace(codes[0], "-", "", 1))
+	if err = m.UseRecoveryCode(ctx, 1, typed); err != nil {
+		t.Errorf("want a valid recovery code; got %v", err)
+	}
+	if err = m.UseRecoveryCode(ctx, 1, codes[0]); err != models.ErrInvalidCredentials {
+		t.Errorf("want a used recovery code refused; got %v", err)
+	}
+	if n, _ := m.RecoveryCodesLeft(ctx, 1); n != recoveryCodeCount-1 {
+		t.Errorf("want %d recovery codes left; got %d", recoveryCodeCount-1, n)
+	}
+
+	if err = m.Disable(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Secret(ctx, 1); got != "" {
+		t.Errorf("want two-factor disabled; got secret %q", got)
+	}
+	if n, _ := m.RecoveryCodesLeft(ctx, 1); n != 0 {
+		t.Errorf("want the recovery codes deleted; got %d", n)
+	}
+	if _, err = m.Secret(ctx, 99); err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+}
+
+func TestSessionModel(t *testing.T) {
+	db := newTestDB(t)
+	m := &SessionModel{DB: db}
+	ctx := context.Background()
+
+	first, err := m.Insert(ctx, 1, "192.0.2.1", "Firefox", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.Insert(ctx, 1, "192.0.2.2", strings.Repeat("x", 300), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := m.Insert(ctx, 1, "192.0.2.3", "Chrome", -time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.Get(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.UserID != 1 || s.IPAddress != "192.0.2.1" || s.UserAgent != "Firefox" {
+		t.Errorf("unexpected session %+v", s)
+	}
+	if err = m.Touch(ctx, s.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"Valid", second, nil},
+		{"Expired", expired, models.ErrNoRecord},
+		{"Unknown", "no-such-token", models.ErrNoRecord},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := m.Get(ctx, tt.token); err != tt.want {
+				t.Errorf("want %v; got %v", tt.want, err)
+			}
+		})
+	}
+
+	sessions, err := m.List(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("want 2 unexpired sessions; got %d", len(sessions))
+	}
+	if len(sessions[0].UserAgent) != maxUserAgent {
+		t.Errorf("want the user agent truncated to %d bytes; got %d", maxUserAgent, len(sessions[0].UserAgent))
+	}
+
+	if err = m.Delete(ctx, 2, s.ID); err != models.ErrNoRecord {
+		t.Errorf("want %v deleting another user's session; got %v", models.ErrNoRecord, err)
+	}
+	if err = m.Delete(ctx, 1, s.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Get(ctx, first); err != models.ErrNoRecord {
+		t.Errorf("want a revoked session gone; got %v", err)
+	}
+
+	if n, err := m.DeleteExpired(ctx); err != nil || n != 1 {
+		t.Errorf("want 1 expired session deleted; got %d, %v", n, err)
+	}
+	if n, err := m.DeleteAll(ctx, 1); err != nil || n != 1 {
+		t.Errorf("want 1 session deleted; got %d, %v", n, err)
+	}
+}
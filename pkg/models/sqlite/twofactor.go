@@ -0,0 +1,184 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"wilbertopachecob/snippetbox/pkg/models"
+	"wilbertopachecob/snippetbox/pkg/models/internal/secret"
+	"wilbertopachecob/snippetbox/pkg/totp"
+)
+
+// recoveryCodeCount is the number of recovery codes a user gets when they
+// enable two-factor authentication.
+const recoveryCodeCount = 10
+
+// TwoFactorModel manages the TOTP secrets and recovery codes of users.
+type TwoFactorModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Secret returns the TOTP secret of the given user, or an empty string if
+// they haven't enabled two-factor authentication.
+func (m *TwoFactorModel) Secret(ctx context.Context, userID int) (string, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `SELECT COALESCE(totp_secret, '') FROM users WHERE id = ?`
+	var secret string
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&secret)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", models.ErrNoRecord
+		}
+		return "", err
+	}
+	return secret, nil
+}
+
+// Enable turns on two-factor authentication for the given user with a
+// secret they have proved they can generate codes for. It returns a new set
+// of recovery codes, replacing any old ones. Only their hashes are stored,
+// so this is the only time the codes are available.
+func (m *TwoFactorModel) Enable(ctx context.Context, userID int, totpSecret string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := secret.NewRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users SET totp_secret = ?, totp_last_step = 0 WHERE id = ?`
+	result, err := tx.ExecContext(ctx, query, totpSecret, userID)
+	if err != nil {
+		return nil, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, models.ErrNoRecord
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		query = `INSERT INTO recovery_codes (user_id, hash) VALUES (?, ?)`
+		_, err = tx.ExecContext(ctx, query, userID, secret.Hash(secret.NormalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns off two-factor authentication for the given user and deletes
+// their recovery codes.
+func (m *TwoFactorModel) Disable(ctx context.Context, userID int) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users SET totp_secret = NULL, totp_last_step = 0 WHERE id = ?`
+	if _, err = tx.ExecContext(ctx, query, userID); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Verify checks a code from the user's authenticator app. A code can only be
+// used once, so a code which was seen by someone else is worthless once the
+// user has logged in with it. If the code is wrong, or the user doesn't have
+// two-factor authentication enabled, we return models.ErrInvalidCredentials.
+func (m *TwoFactorModel) Verify(ctx context.Context, userID int, code string) error {
+	secret, err := m.Secret(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		return models.ErrInvalidCredentials
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return models.ErrInvalidCredentials
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`
+	result, err := m.DB.ExecContext(ctx, query, step, userID, step)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrInvalidCredentials
+	}
+	return nil
+}
+
+// UseRecoveryCode checks one of the user's recovery codes and deletes it, so
+// that it can't be used again. If the code doesn't exist we return
+// models.ErrInvalidCredentials.
+func (m *TwoFactorModel) UseRecoveryCode(ctx context.Context, userID int, code string) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `DELETE FROM recovery_codes WHERE user_id = ? AND hash = ?`
+	result, err := m.DB.ExecContext(ctx, query, userID, secret.Hash(secret.NormalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrInvalidCredentials
+	}
+	return nil
+}
+
+// RecoveryCodesLeft returns the number of unused recovery codes of the given
+// user.
+func (m *TwoFactorModel) RecoveryCodesLeft(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	query := `SELECT COUNT(*) FROM recovery_codes WHERE user_id = ?`
+	var n int
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&n)
+	return n, err
+}
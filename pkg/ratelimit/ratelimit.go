@@ -0,0 +1,113 @@
+// Package ratelimit implements token bucket rate limiting. Every key, such as
+// a client IP address, has its own bucket of tokens which refills at a steady
+// rate. Each request takes a token and is refused once the bucket is empty.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Bucket is the state of the token bucket of a single key.
+type Bucket struct {
+	Tokens float64
+	// Updated is when Tokens was last computed. It is the zero time for a
+	// key which hasn't been seen before.
+	Updated time.Time
+}
+
+// Store keeps the buckets of a Limiter. Implementations can keep them in
+// memory, like MemoryStore, or share them between several servers.
+type Store interface {
+	// Update calls fn with the bucket of key and saves the bucket once fn
+	// returns. Calls for the same key must not run concurrently.
+	Update(key string, fn func(b *Bucket))
+}
+
+// Limiter allows Burst requests per key at once, and then one more every
+// Every.
+type Limiter struct {
+	Every time.Duration
+	Burst int
+	Store Store
+	// now returns the current time. It is replaced in tests.
+	now func() time.Time
+}
+
+// New returns a limiter which keeps its buckets in store.
+func New(every time.Duration, burst int, store Store) *Limiter {
+	return &Limiter{Every: every, Burst: burst, Store: store, now: time.Now}
+}
+
+// Allow takes a token from the bucket of key. If the bucket is empty it
+// returns false along with how long it will take for a token to be available.
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	now := l.now()
+	burst := float64(l.Burst)
+
+	l.Store.Update(key, func(b *Bucket) {
+		if b.Updated.IsZero() {
+			b.Tokens = burst
+		} else if elapsed := now.Sub(b.Updated); elapsed > 0 {
+			b.Tokens = math.Min(burst, b.Tokens+float64(elapsed)/float64(l.Every))
+		}
+		b.Updated = now
+
+		if b.Tokens >= 1 {
+			b.Tokens--
+			ok = true
+			return
+		}
+		retryAfter = time.Duration((1 - b.Tokens) * float64(l.Every))
+	})
+	return ok, retryAfter
+}
+
+// MemoryStore keeps buckets in memory. Buckets which haven't been used for
+// TTL are dropped, so the store doesn't grow forever. TTL should be at least
+// the time a bucket takes to refill completely, since a dropped bucket starts
+// again full.
+type MemoryStore struct {
+	TTL time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*Bucket
+	lastPrune time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{TTL: ttl, buckets: make(map[string]*Bucket), lastPrune: time.Now()}
+}
+
+// Update implements Store. Every call holds a single lock, which is fine for
+// the small number of requests which are rate limited.
+func (s *MemoryStore) Update(key string, fn func(b *Bucket)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPrune) > s.TTL {
+		for k, b := range s.buckets {
+			if now.Sub(b.Updated) > s.TTL {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastPrune = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &Bucket{}
+		s.buckets[key] = b
+	}
+	fn(b)
+}
+
+// Len returns the number of buckets in the store.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	l := New(time.Minute, 2, NewMemoryStore(time.Hour))
+	l.now = func() time.Time { return now }
+
+	tests := []struct {
+		name           string
+		key            string
+		advance        time.Duration
+		wantOK         bool
+		wantRetryAfter time.Duration
+	}{
+		{"First token", "a", 0, true, 0},
+		{"Second token", "a", 0, true, 0},
+		{"Empty bucket", "a", 0, false, time.Minute},
+		{"Partly refilled", "a", 15 * time.Second, false, 45 * time.Second},
+		{"Refilled", "a", 45 * time.Second, true, 0},
+		{"Other key", "b", 0, true, 0},
+		{"Refills up to the burst", "a", time.Hour, true, 0},
+		{"Still has one token", "a", 0, true, 0},
+		{"Empty again", "a", 0, false, time.Minute},
+	}
+
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		ok, retryAfter := l.Allow(tt.key)
+		if ok != tt.wantOK {
+			t.Errorf("%s: want ok %v; got %v", tt.name, tt.wantOK, ok)
+		}
+		if retryAfter != tt.wantRetryAfter {
+			t.Errorf("%s: want retry after %v; got %v", tt.name, tt.wantRetryAfter, retryAfter)
+		}
+	}
+}
+
+func TestMemoryStorePrune(t *testing.T) {
+	s := NewMemoryStore(time.Millisecond)
+	l := New(time.Second, 1, s)
+
+	l.Allow("a")
+	time.Sleep(5 * time.Millisecond)
+	l.Allow("b")
+
+	if n := s.Len(); n != 1 {
+		t.Errorf("want the idle bucket dropped; got %d buckets", n)
+	}
+}
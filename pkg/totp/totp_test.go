@@ -0,0 +1,92 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 secret of the test vectors in RFC 6238 appendix B,
+// "12345678901234567890", base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// The RFC lists 8 digit codes. Our 6 digit codes are their last 6
+	// digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("at %d: want %s; got %s", tt.unix, tt.want, got)
+		}
+	}
+
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("want an error for an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current, _ := Code(rfcSecret, Step(now))
+	previous, _ := Code(rfcSecret, Step(now)-1)
+	old, _ := Code(rfcSecret, Step(now)-2)
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"Current code", current, Step(now), true},
+		{"With spaces", " " + current + " ", Step(now), true},
+		{"Previous code", previous, Step(now) - 1, true},
+		{"Too old", old, 0, false},
+		{"Wrong length", "12345", 0, false},
+		{"Wrong code", "000000", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("want %d, %v; got %d, %v", tt.wantStep, tt.wantOK, step, ok)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("want a 32 character secret; got %q", secret)
+	}
+	if _, err = Code(secret, 1); err != nil {
+		t.Errorf("want a usable secret; got %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("Snippetbox", "alice@example.com", rfcSecret)
+	want := []string{"otpauth://totp/Snippetbox:alice@example.com?", "secret=" + rfcSecret, "issuer=Snippetbox", "digits=6", "period=30"}
+	for _, w := range want {
+		if !strings.Contains(got, w) {
+			t.Errorf("want %q to contain %q", got, w)
+		}
+	}
+}
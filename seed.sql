@@ -0,0 +1,6 @@
+-- Sample data for a MySQL database. Apply the schema first with:
+--
+--   go run ./cmd/cli migrate up
+
+INSERT INTO `users` VALUES (1,'admin','admin@gmail.com','$2a$12$nXOJeXwyjl.9t3KLce/5GuWCCtBKghgqb2HlAlkF2QCPrm9hBfEzK','2021-04-06 21:42:03');
+INSERT INTO `snippets` VALUES (1,1,'An old silent pond','An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.','plaintext','public',NULL,'2021-04-01 19:35:02','2022-04-01 19:35:02'),(2,1,'Over the wintry forest','Over the wintry\nforest, winds howl in rage\nwith no leaves to blow.\n\n– N','plaintext','public',NULL,'2021-04-01 19:35:02','2022-04-01 19:35:02'),(3,1,'First autumn morning','First autumn morning\nthe mirror I stare into\nshows my father\'s face.\n\'','plaintext','public',NULL,'2021-04-01 19:35:02','2021-04-08 19:35:02'),(4,1,'O snail','O snail\nClimb Mount Fuji,\nBut slowly, slowly!\n\n– Kobayashi','plaintext','public',NULL,'2021-04-01 21:31:53','2021-04-08 21:31:53'),(5,1,'Spider-Man: Far from Home','Is a great movie\r\n\r\n-Wilberto Pacheco','plaintext','public',NULL,'2021-04-05 18:32:11','2022-04-05 18:32:11'),(6,1,'Improving correct values validation','Lorem ipsum\r\n\r\n-Wilberto Pacheco','plaintext','public',NULL,'2021-04-06 16:32:22','2022-04-06 16:32:22');